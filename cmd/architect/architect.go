@@ -1,6 +1,7 @@
 package architect
 
 import (
+	"context"
 	"github.com/Sirupsen/logrus"
 	"github.com/skatteetaten/architect/pkg/config"
 	"github.com/skatteetaten/architect/pkg/docker"
@@ -60,7 +61,7 @@ var JavaLeveransepakke = &cobra.Command{
 		} else {
 			mavenRepo := "http://aurora/nexus/service/local/artifact/maven/content"
 			logrus.Debugf("Using Maven repo on %s", mavenRepo)
-			nexusDownloader = nexus.NewNexusDownloader(mavenRepo)
+			nexusDownloader = nexus.NewNexusDownloader(mavenRepo, c.RetrySpec.RetryPolicy())
 		}
 
 		RunArchitect(RunConfiguration{
@@ -82,24 +83,26 @@ func RunArchitect(configuration RunConfiguration) {
 	c := configuration.Config
 	logrus.Debugf("Config %+v", c)
 
-	registryCredentials, err := configuration.RegistryCredentialsFunc(c.DockerSpec.OutputRegistry)
+	// The build is stopped on SIGTERM and SIGINT
+	ctx, cancel := util.NewSignalContext()
+	defer cancel()
 
-	if err != nil {
-		logrus.Fatal("Cound not parse registry credentials", err)
-	}
+	// Credentials are resolved for each registry the build uses
+	registryCredentials := docker.CachedRegistryCredentials(
+		docker.OutputTargetCredentials(c.DockerSpec.OutputTargets, configuration.RegistryCredentialsFunc))
 
 	if c.DockerSpec.RetagWith != "" {
 		logrus.Info("Perform retag")
-		if err := retag.Retag(c, registryCredentials); err != nil {
+		if err := retag.Retag(ctx, c, registryCredentials); err != nil {
 			logrus.Fatal("Failed to retag temporary image", err)
 		}
 	} else {
-		performBuild(&configuration, c, registryCredentials)
+		performBuild(ctx, &configuration, c, registryCredentials)
 
 	}
 
 }
-func performBuild(configuration *RunConfiguration, c *config.Config, r *docker.RegistryCredentials) {
+func performBuild(ctx context.Context, configuration *RunConfiguration, c *config.Config, r docker.RegistryCredentialsFunc) {
 	var prepper process.Prepper
 	if c.ApplicationType == config.JavaLeveransepakke {
 		logrus.Info("Perform Java build")
@@ -110,11 +113,13 @@ func performBuild(configuration *RunConfiguration, c *config.Config, r *docker.R
 		prepper = prepare.Prepper()
 	}
 
-	if c.BinaryBuild && !c.ApplicationSpec.MavenGav.IsSnapshot() {
+	// Releases should come from Nexus, unless the version is derived from git
+	if c.BinaryBuild && !c.ApplicationSpec.MavenGav.IsSnapshot() &&
+		c.ApplicationSpec.VersionSource != config.GitVersionSource {
 		logrus.Fatalf("Trying to build a release as binary build? Sorry, only SNAPSHOTS;)")
 	}
 
-	if err := process.Build(r, c, configuration.NexusDownloader, prepper); err != nil {
+	if err := process.Build(ctx, r, c, configuration.NexusDownloader, prepper); err != nil {
 		logrus.Errorf("Failed to build image: %+v", err)
 		logrus.Fatal("Terminating")
 	}
@@ -0,0 +1,95 @@
+package architect
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/process/impact"
+	"github.com/skatteetaten/architect/pkg/util"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var impactOutput string
+var impactPrefix string
+var impactConcurrency int
+
+var Impact = &cobra.Command{
+
+	Use:   "impact REGISTRY BASEIMAGE:VERSION|BASEIMAGE@DIGEST",
+	Short: "Find the images built on a base image",
+	Long: `Find the images in a registry that are built on a version of a base image.
+
+The repositories of the registry are searched for complete version tags with the name and version
+of the base image, e.g. 2.0.0-b1.11.0-oracle8-1.0.2 for aurora/oracle8:1.0.2. Given a digest, the
+base image label of each image built on the base image is checked instead.
+
+The images are printed as repository:tag, or as a JSON report with --output json.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if verbose {
+			logrus.SetLevel(logrus.DebugLevel)
+		} else {
+			logrus.SetLevel(logrus.InfoLevel)
+		}
+		if len(args) != 2 {
+			logrus.Fatal("Expected a registry and a base image")
+		}
+		if impactOutput != "text" && impactOutput != "json" {
+			logrus.Fatalf("Unknown output %s. Expected text or json", impactOutput)
+		}
+		registry := args[0]
+		query := parseBaseImageQuery(args[1])
+		query.Prefix = impactPrefix
+
+		credentials, err := docker.LocalRegistryCredentials()(registry)
+		if err != nil {
+			logrus.Warnf("Could not read registry credentials, trying anonymous access: %s", err)
+			credentials = nil
+		}
+
+		ctx, cancel := util.NewSignalContext()
+		defer cancel()
+		report, err := impact.Analyze(ctx, docker.NewRegistryApi(registry, credentials), registry, query,
+			impactConcurrency)
+		if err != nil {
+			logrus.Fatalf("Impact analysis failed: %s", err)
+		}
+
+		if impactOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				logrus.Fatalf("Failed to write report: %s", err)
+			}
+		} else {
+			for _, image := range report.Images {
+				fmt.Printf("%s:%s\n", image.Repository, image.Tag)
+			}
+		}
+		logrus.Infof("Found %d images built on %s", len(report.Images), args[1])
+		if len(report.Failed) > 0 {
+			logrus.Warnf("Could not search %d repositories: %s", len(report.Failed), strings.Join(report.Failed, ", "))
+		}
+	},
+}
+
+// The base image is given as repository:version or repository@digest, without registry
+func parseBaseImageQuery(baseImage string) impact.Query {
+	if i := strings.Index(baseImage, "@"); i >= 0 {
+		return impact.Query{BaseImage: baseImage[:i], BaseDigest: baseImage[i+1:]}
+	}
+	if i := strings.LastIndex(baseImage, ":"); i > strings.LastIndex(baseImage, "/") {
+		return impact.Query{BaseImage: baseImage[:i], BaseVersion: baseImage[i+1:]}
+	}
+	return impact.Query{BaseImage: baseImage}
+}
+
+func init() {
+	Impact.Flags().StringVarP(&impactOutput, "output", "o", "text", "Output format, text or json")
+	Impact.Flags().StringVar(&impactPrefix, "prefix", "", "Only search repositories with this prefix, e.g. aurora/")
+	Impact.Flags().IntVar(&impactConcurrency, "concurrency", util.DefaultConcurrency,
+		"Number of repositories searched at the same time")
+	Impact.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose logging")
+}
@@ -0,0 +1,67 @@
+package architect
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/signing"
+	"github.com/skatteetaten/architect/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var publicKeyFile string
+
+var Verify = &cobra.Command{
+
+	Use:   "verify IMAGE",
+	Short: "Verify the signature of an image",
+	Long: `Verify that an image pushed by Architect is signed with the given key.
+
+The image is given as registry/repository:tag or registry/repository@digest. The signature is
+compatible with cosign, so the same key can be used with cosign verify --key.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if verbose {
+			logrus.SetLevel(logrus.DebugLevel)
+		} else {
+			logrus.SetLevel(logrus.InfoLevel)
+		}
+		if len(args) != 1 {
+			logrus.Fatal("Expected exactly one image to verify")
+		}
+		if publicKeyFile == "" {
+			logrus.Fatal("No public key given. Use --key")
+		}
+
+		registry, repository, reference, err := signing.ParseImageName(args[0])
+		if err != nil {
+			logrus.Fatalf("Could not parse image name: %s", err)
+		}
+
+		key, err := signing.ReadPublicKeyFile(publicKeyFile)
+		if err != nil {
+			logrus.Fatalf("Could not read public key: %s", err)
+		}
+
+		credentials, err := docker.LocalRegistryCredentials()(registry)
+		if err != nil {
+			logrus.Warnf("Could not read registry credentials, trying anonymous access: %s", err)
+			credentials = nil
+		}
+
+		verifier := &signing.Verifier{
+			Key:      key,
+			Registry: docker.NewRegistryApi(registry, credentials),
+		}
+		ctx, cancel := util.NewSignalContext()
+		defer cancel()
+		digest, err := verifier.VerifyImage(ctx, registry, repository, reference)
+		if err != nil {
+			logrus.Fatalf("Verification of %s failed: %s", args[0], err)
+		}
+		logrus.Infof("Verified signature of %s/%s@%s", registry, repository, digest)
+	},
+}
+
+func init() {
+	Verify.Flags().StringVarP(&publicKeyFile, "key", "k", "", "Path to the PEM encoded public key")
+	Verify.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose logging")
+}
@@ -3,11 +3,13 @@ package cmd
 import (
 	"fmt"
 	"github.com/skatteetaten/architect/cmd/architect"
+	"github.com/skatteetaten/architect/pkg/util"
 	"github.com/spf13/cobra"
 	"os"
 )
 
 var cfgFile string
+var logFormat string
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -34,6 +36,9 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	RootCmd.AddCommand(architect.JavaLeveransepakke)
+	RootCmd.AddCommand(architect.Verify)
+	RootCmd.AddCommand(architect.Impact)
+	RootCmd.PersistentFlags().StringVar(&logFormat, "log-format", util.TextLogFormat, "Log format, text or json")
 	// Here you will define your flags and configuration settings.
 	// Cobra supports Persistent Flags, which, if defined here,
 	// will be global for your application.
@@ -46,5 +51,8 @@ func init() {
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-	//TODO
+	if err := util.SetLogFormat(logFormat); err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
 }
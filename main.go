@@ -35,6 +35,9 @@ func main() {
 	}
 }
 func initializeAndRunOnOpenShift() {
+	if err := util.SetLogFormat(os.Getenv("LOG_FORMAT")); err != nil {
+		logrus.Fatalf("Invalid LOG_FORMAT: %s", err)
+	}
 	if len(os.Getenv("DEBUG")) > 0 {
 		logrus.SetLevel(logrus.DebugLevel)
 	} else {
@@ -66,7 +69,7 @@ func initializeAndRunOnOpenShift() {
 		}
 		nexusDownloader = nexus.NewBinaryDownloader(binaryInput)
 	} else {
-		nexusDownloader = nexus.NewNexusDownloader(mavenRepo)
+		nexusDownloader = nexus.NewNexusDownloader(mavenRepo, c.RetrySpec.RetryPolicy())
 	}
 	runConfig := architect.RunConfiguration{
 		Config:    cfg,
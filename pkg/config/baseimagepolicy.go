@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	extVersion "github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+)
+
+// BaseImagePolicy restricts which base images builds may use. It is typically mounted into the build from
+// a config map, so that it is maintained in one place.
+//
+// Example:
+//
+//	{"baseImages": [
+//	  {"name": "aurora/wingnut11", "minVersion": "1.2.0"},
+//	  {"name": "aurora/oracle8", "deprecated": "Use aurora/wingnut11"}
+//	], "failAfterEol": true}
+type BaseImagePolicy struct {
+	// Base images that may be used. All base images may be used if empty
+	BaseImages []AllowedBaseImage `json:"baseImages,omitempty"`
+	// Fail the build on a deprecated base image, instead of warning
+	FailOnDeprecated bool `json:"failOnDeprecated,omitempty"`
+	// Fail the build on a base image that is past its end of life date
+	FailAfterEol bool `json:"failAfterEol,omitempty"`
+}
+
+type AllowedBaseImage struct {
+	Name string `json:"name"`
+	// Lowest BASE_IMAGE_VERSION of the base image that may be used
+	MinVersion string `json:"minVersion,omitempty"`
+	// Marks the base image as deprecated, with the message
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+// Find returns the entry of the base image, or nil if it is not in the policy
+func (m *BaseImagePolicy) Find(name string) *AllowedBaseImage {
+	for i, baseImage := range m.BaseImages {
+		if baseImage.Name == name {
+			return &m.BaseImages[i]
+		}
+	}
+	return nil
+}
+
+func (m *BaseImagePolicy) validate() error {
+	for i, baseImage := range m.BaseImages {
+		if strings.TrimSpace(baseImage.Name) == "" {
+			return errors.Errorf("Base image policy entry %d requires a name", i)
+		}
+		if baseImage.MinVersion != "" {
+			if _, err := extVersion.NewVersion(baseImage.MinVersion); err != nil {
+				return errors.Wrapf(err, "Base image policy entry %s has an invalid minVersion", baseImage.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseBaseImagePolicy reads a JSON base image policy
+func ParseBaseImagePolicy(data []byte) (*BaseImagePolicy, error) {
+	policy := &BaseImagePolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal base image policy")
+	}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// ReadBaseImagePolicyFile reads a JSON base image policy from file
+func ReadBaseImagePolicyFile(path string) (*BaseImagePolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read base image policy file %s", path)
+	}
+	return ParseBaseImagePolicy(data)
+}
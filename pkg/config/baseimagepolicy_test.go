@@ -0,0 +1,26 @@
+package config_test
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseBaseImagePolicy(t *testing.T) {
+	policy, err := config.ParseBaseImagePolicy([]byte(`{"baseImages": [
+		{"name": "aurora/wingnut11", "minVersion": "1.2.0"},
+		{"name": "aurora/oracle8", "deprecated": "Use aurora/wingnut11"}
+	], "failAfterEol": true}`))
+	assert.NoError(t, err)
+	assert.True(t, policy.FailAfterEol)
+	assert.False(t, policy.FailOnDeprecated)
+	assert.Equal(t, "Use aurora/wingnut11", policy.Find("aurora/oracle8").Deprecated)
+	assert.Nil(t, policy.Find("aurora/wrench"))
+}
+
+func TestParseBaseImagePolicyValidation(t *testing.T) {
+	_, err := config.ParseBaseImagePolicy([]byte(`{"baseImages": [{"minVersion": "1.2.0"}]}`))
+	assert.Error(t, err)
+	_, err = config.ParseBaseImagePolicy([]byte(`{"baseImages": [{"name": "aurora/oracle8", "minVersion": "one"}]}`))
+	assert.Error(t, err)
+}
@@ -4,11 +4,15 @@ import (
 	"encoding/json"
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/reference"
+	extVersion "github.com/hashicorp/go-version"
 	"github.com/pkg/errors"
 	"github.com/skatteetaten/architect/pkg/config/api"
 	"io/ioutil"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ConfigReader interface {
@@ -73,17 +77,47 @@ func newConfig(buildConfig []byte) (*Config, error) {
 	}
 
 	applicationSpec := ApplicationSpec{}
+	applicationSpec.VersionSource = MavenVersionSource
+	if versionSource, err := findEnv(env, "VERSION_SOURCE"); err == nil {
+		switch VersionSource(strings.ToLower(versionSource)) {
+		case MavenVersionSource:
+		case GitVersionSource:
+			applicationSpec.VersionSource = GitVersionSource
+		default:
+			return nil, errors.Errorf("Unknown VERSION_SOURCE %s. Only maven and git supported", versionSource)
+		}
+	}
+	// A version derived from git is not in Nexus, so the deliverable must be given as binary input
+	gitVersioned := applicationSpec.VersionSource == GitVersionSource
+	if gitVersioned && build.Spec.Source.Type != api.BuildSourceBinary {
+		return nil, errors.New("VERSION_SOURCE git requires a binary build, as the deliverable is not in Nexus")
+	}
+
+	// The Maven coordinates are optional when the deliverable is not downloaded from Nexus
 	if artifactId, err := findEnv(env, "ARTIFACT_ID"); err == nil {
 		applicationSpec.MavenGav.ArtifactId = artifactId
-	} else {
+	} else if !gitVersioned {
 		return nil, err
 	}
 	if groupId, err := findEnv(env, "GROUP_ID"); err == nil {
 		applicationSpec.MavenGav.GroupId = groupId
-	} else {
+	} else if !gitVersioned {
 		return nil, err
 	}
-	if version, err := findEnv(env, "VERSION"); err == nil {
+
+	sourceSpec, err := findSourceSpec(build, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if applicationSpec.VersionSource == GitVersionSource {
+		gitVersion, err := NewGitVersion(sourceSpec)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Debugf("Using version %s derived from git", gitVersion.AppVersion)
+		applicationSpec.MavenGav.Version = gitVersion.GivenVersion
+	} else if version, err := findEnv(env, "VERSION"); err == nil {
 		applicationSpec.MavenGav.Version = version
 	} else {
 		return nil, err
@@ -121,10 +155,25 @@ func newConfig(buildConfig []byte) (*Config, error) {
 		dockerSpec.ExternalDockerRegistry = "https://docker-registry.aurora.sits.no:5000"
 	}
 
+	if mirrors, err := findEnv(env, "BASE_IMAGE_REGISTRY_MIRRORS"); err == nil {
+		for _, mirror := range strings.Split(mirrors, ",") {
+			if mirror = strings.TrimSpace(mirror); mirror == "" {
+				continue
+			} else if strings.HasPrefix(mirror, "https://") {
+				dockerSpec.ExternalDockerRegistryMirrors = append(dockerSpec.ExternalDockerRegistryMirrors, mirror)
+			} else {
+				dockerSpec.ExternalDockerRegistryMirrors = append(dockerSpec.ExternalDockerRegistryMirrors, "https://"+mirror)
+			}
+		}
+	}
+
 	if pushExtraTags, err := findEnv(env, "PUSH_EXTRA_TAGS"); err == nil {
-		dockerSpec.PushExtraTags = ParseExtraTags(pushExtraTags)
+		dockerSpec.PushExtraTags, err = ParseExtraTags(pushExtraTags)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid PUSH_EXTRA_TAGS")
+		}
 	} else {
-		dockerSpec.PushExtraTags = ParseExtraTags("latest,major,minor,patch")
+		dockerSpec.PushExtraTags = PushExtraTags{Latest: true, Major: true, Minor: true, Patch: true}
 	}
 
 	if temporaryTag, err := findEnv(env, "TAG_WITH"); err == nil {
@@ -135,6 +184,18 @@ func newConfig(buildConfig []byte) (*Config, error) {
 		dockerSpec.RetagWith = temporaryTag
 	}
 
+	if tagPolicy, err := findEnv(env, "TAG_POLICY"); err == nil {
+		dockerSpec.TagPolicy, err = ParseTagPolicy([]byte(tagPolicy))
+		if err != nil {
+			return nil, err
+		}
+	} else if tagPolicyFile, err := findEnv(env, "TAG_POLICY_FILE"); err == nil {
+		dockerSpec.TagPolicy, err = ReadTagPolicyFile(tagPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	dockerSpec.TagOverwrite = false
 	if tagOverwrite, err := findEnv(env, "TAG_OVERWRITE"); err == nil {
 		if strings.Contains(strings.ToLower(tagOverwrite), "true") {
@@ -142,6 +203,101 @@ func newConfig(buildConfig []byte) (*Config, error) {
 		}
 	}
 
+	if targets, err := findEnv(env, "OUTPUT_TARGETS"); err == nil {
+		dockerSpec.OutputTargets, err = ParseOutputTargets([]byte(targets))
+		if err != nil {
+			return nil, err
+		}
+	}
+	outputMode, _ := findEnv(env, "OUTPUT_MODE")
+	if dockerSpec.OutputMode, err = ParseOutputMode(outputMode); err != nil {
+		return nil, err
+	}
+
+	if platforms, err := findEnv(env, "PLATFORMS"); err == nil {
+		for _, platform := range strings.Split(platforms, ",") {
+			if platform = strings.TrimSpace(platform); platform != "" {
+				dockerSpec.Platforms = append(dockerSpec.Platforms, platform)
+			}
+		}
+	}
+
+	signingSpec := SigningSpec{}
+	if keyFile, err := findEnv(env, "SIGNING_KEY_FILE"); err == nil {
+		signingSpec.KeyFile = keyFile
+	}
+	if passwordFile, err := findEnv(env, "SIGNING_KEY_PASSWORD_FILE"); err == nil {
+		signingSpec.PasswordFile = passwordFile
+	}
+
+	vulnerabilitySpec := VulnerabilitySpec{}
+	if databaseFile, err := findEnv(env, "VULNERABILITY_DB_FILE"); err == nil {
+		vulnerabilitySpec.DatabaseFile = databaseFile
+	}
+	if severity, err := findEnv(env, "VULNERABILITY_FAIL_SEVERITY"); err == nil {
+		vulnerabilitySpec.FailSeverity = severity
+	}
+	if severity, err := findEnv(env, "VULNERABILITY_WARN_SEVERITY"); err == nil {
+		vulnerabilitySpec.WarnSeverity = severity
+	}
+
+	timeoutSpec := TimeoutSpec{}
+	for name, timeout := range map[string]*time.Duration{
+		"DOWNLOAD_TIMEOUT": &timeoutSpec.Download,
+		"BUILD_TIMEOUT":    &timeoutSpec.Build,
+		"PUSH_TIMEOUT":     &timeoutSpec.Push,
+	} {
+		if value, err := findEnv(env, name); err == nil {
+			*timeout, err = time.ParseDuration(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid %s. Expected a duration like 10m", name)
+			}
+		}
+	}
+
+	retrySpec := RetrySpec{}
+	if value, err := findEnv(env, "RETRY_ATTEMPTS"); err == nil {
+		retrySpec.Attempts, err = strconv.Atoi(value)
+		if err != nil || retrySpec.Attempts < 1 {
+			return nil, errors.Errorf("Invalid RETRY_ATTEMPTS %s. Expected a number greater than zero", value)
+		}
+	}
+	for name, backoff := range map[string]*time.Duration{
+		"RETRY_BACKOFF":     &retrySpec.InitialBackoff,
+		"RETRY_MAX_BACKOFF": &retrySpec.MaxBackoff,
+	} {
+		if value, err := findEnv(env, name); err == nil {
+			*backoff, err = time.ParseDuration(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid %s. Expected a duration like 5s", name)
+			}
+		}
+	}
+
+	concurrency := 0
+	if value, err := findEnv(env, "CONCURRENCY"); err == nil {
+		concurrency, err = strconv.Atoi(value)
+		if err != nil || concurrency < 1 {
+			return nil, errors.Errorf("Invalid CONCURRENCY %s. Expected a number greater than zero", value)
+		}
+	}
+
+	metricsSpec := MetricsSpec{}
+	if url, err := findEnv(env, "METRICS_PUSHGATEWAY_URL"); err == nil {
+		metricsSpec.PushgatewayUrl = url
+	}
+	if file, err := findEnv(env, "METRICS_FILE"); err == nil {
+		metricsSpec.File = file
+	}
+
+	tracingSpec := TracingSpec{}
+	if endpoint, err := findEnv(env, "OTEL_EXPORTER_OTLP_ENDPOINT"); err == nil {
+		tracingSpec.Endpoint = endpoint
+	}
+	if file, err := findEnv(env, "TRACING_FILE"); err == nil {
+		tracingSpec.File = file
+	}
+
 	builderSpec := BuilderSpec{}
 
 	if builderVersion, present := os.LookupEnv("APP_VERSION"); present {
@@ -195,21 +351,82 @@ func newConfig(buildConfig []byte) (*Config, error) {
 		if err != nil {
 			return nil, err
 		}
-		dockerSpec.PushExtraTags = ParseExtraTags("")
+		dockerSpec.PushExtraTags = PushExtraTags{}
 	} else {
 		return nil, errors.Errorf("Unknown outputkind. Only DockerImage and ImageStreamTag supported, was %s", outputKind)
 	}
 	logrus.Debugf("Pushing to %s/%s:%s", dockerSpec.OutputRegistry, dockerSpec.OutputRepository, dockerSpec.TagWith)
+	// The application is named by the output repository if it has no artifact id
+	if applicationSpec.MavenGav.ArtifactId == "" {
+		applicationSpec.MavenGav.ArtifactId = path.Base(dockerSpec.OutputRepository)
+	}
 	c := &Config{
-		ApplicationType: applicationType,
-		ApplicationSpec: applicationSpec,
-		DockerSpec:      dockerSpec,
-		BuilderSpec:     builderSpec,
-		BinaryBuild:     build.Spec.Source.Type == api.BuildSourceBinary,
+		ApplicationType:   applicationType,
+		ApplicationSpec:   applicationSpec,
+		DockerSpec:        dockerSpec,
+		BuilderSpec:       builderSpec,
+		SourceSpec:        sourceSpec,
+		BuildMetadata:     findBuildMetadata(build),
+		SigningSpec:       signingSpec,
+		VulnerabilitySpec: vulnerabilitySpec,
+		TimeoutSpec:       timeoutSpec,
+		RetrySpec:         retrySpec,
+		MetricsSpec:       metricsSpec,
+		TracingSpec:       tracingSpec,
+		BinaryBuild:       build.Spec.Source.Type == api.BuildSourceBinary,
+		Concurrency:       concurrency,
 	}
 	return c, nil
 }
 
+func findSourceSpec(build api.Build, env map[string]string) (SourceSpec, error) {
+	sourceSpec := SourceSpec{}
+	if build.Spec.Source.Git != nil {
+		sourceSpec.GitUri = build.Spec.Source.Git.URI
+		sourceSpec.GitRef = build.Spec.Source.Git.Ref
+	}
+	if build.Spec.Revision != nil && build.Spec.Revision.Git != nil {
+		sourceSpec.GitCommit = build.Spec.Revision.Git.Commit
+	}
+	// A binary build has no git source, and the revision in the build does not know about tags and commit count.
+	// This can be given by the pipeline
+	if gitUri, err := findEnv(env, "GIT_URI"); err == nil {
+		sourceSpec.GitUri = gitUri
+	}
+	if gitRef, err := findEnv(env, "GIT_REF"); err == nil {
+		sourceSpec.GitRef = gitRef
+	}
+	if strings.HasPrefix(sourceSpec.GitRef, "refs/tags/") {
+		sourceSpec.GitTag = strings.TrimPrefix(sourceSpec.GitRef, "refs/tags/")
+	}
+	if gitTag, err := findEnv(env, "GIT_TAG"); err == nil {
+		sourceSpec.GitTag = gitTag
+	}
+	if commitCount, err := findEnv(env, "GIT_COMMIT_COUNT"); err == nil {
+		sourceSpec.GitCommitCount, err = strconv.Atoi(commitCount)
+		if err != nil {
+			return sourceSpec, errors.Wrapf(err, "Invalid GIT_COMMIT_COUNT %s", commitCount)
+		}
+	}
+	return sourceSpec, nil
+}
+
+func findBuildMetadata(build api.Build) BuildMetadata {
+	buildMetadata := BuildMetadata{
+		Name:            build.Name,
+		Namespace:       build.Namespace,
+		BuildConfigName: build.Annotations["openshift.io/build-config.name"],
+		BuildNumber:     build.Annotations["openshift.io/build.number"],
+	}
+	if buildMetadata.BuildConfigName == "" {
+		buildMetadata.BuildConfigName = build.Labels["openshift.io/build-config.name"]
+	}
+	if customStrategy := build.Spec.Strategy.CustomStrategy; customStrategy != nil {
+		buildMetadata.BuilderImage = customStrategy.From.Name
+	}
+	return buildMetadata
+}
+
 func findBaseImage(env map[string]string) (DockerBaseImageSpec, error) {
 	baseSpec := DockerBaseImageSpec{}
 	if baseImage, err := findEnv(env, "DOCKER_BASE_IMAGE"); err == nil {
@@ -225,6 +442,18 @@ func findBaseImage(env map[string]string) (DockerBaseImageSpec, error) {
 	} else {
 		return baseSpec, err
 	}
+	if baseSpec.IsVersionConstraint() {
+		if _, err := extVersion.NewConstraint(baseSpec.BaseVersion); err != nil {
+			return baseSpec, errors.Wrapf(err, "Invalid version constraint in DOCKER_BASE_VERSION")
+		}
+	}
+	if policyFile, err := findEnv(env, "BASE_IMAGE_POLICY_FILE"); err == nil {
+		policy, err := ReadBaseImagePolicyFile(policyFile)
+		if err != nil {
+			return baseSpec, err
+		}
+		baseSpec.Policy = policy
+	}
 	return baseSpec, nil
 }
 
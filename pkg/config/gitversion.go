@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+type VersionSource string
+
+const (
+	// The version is given by VERSION in the Maven GAV (default)
+	MavenVersionSource VersionSource = "maven"
+	// The version is derived from the git revision of the build
+	GitVersionSource VersionSource = "git"
+)
+
+var releaseTagPattern = regexp.MustCompile(`^v?([0-9]+\.[0-9]+\.[0-9]+)$`)
+
+var invalidVersionCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// GitVersion is the application version derived from git metadata.
+//
+// A release tag, v1.2.3 or 1.2.3, gives the release version 1.2.3. Otherwise the build is a snapshot
+// of the current branch, e.g. given version "feature_x-SNAPSHOT" and app version "SNAPSHOT-feature_x-42-ab543b3"
+// where 42 is the commit count and ab543b3 is the short commit SHA.
+type GitVersion struct {
+	AppVersion   string
+	GivenVersion string
+	Snapshot     bool
+}
+
+func NewGitVersion(source SourceSpec) (*GitVersion, error) {
+	if match := releaseTagPattern.FindStringSubmatch(source.GitTag); match != nil {
+		return &GitVersion{
+			AppVersion:   match[1],
+			GivenVersion: match[1],
+			Snapshot:     false,
+		}, nil
+	}
+
+	if source.GitCommit == "" {
+		return nil, errors.New("Unable to derive version from git. The build has neither a release tag nor a commit")
+	}
+
+	branch := source.GitBranch()
+	if branch == "" {
+		branch = "HEAD"
+	}
+	branch = invalidVersionCharacters.ReplaceAllString(branch, "_")
+
+	snapshotVersion := []string{"SNAPSHOT", branch}
+	if source.GitCommitCount > 0 {
+		snapshotVersion = append(snapshotVersion, fmt.Sprintf("%d", source.GitCommitCount))
+	}
+	snapshotVersion = append(snapshotVersion, source.ShortCommit())
+
+	return &GitVersion{
+		AppVersion:   strings.Join(snapshotVersion, "-"),
+		GivenVersion: branch + "-SNAPSHOT",
+		Snapshot:     true,
+	}, nil
+}
+
+// GitBranch returns the branch of the git ref, or an empty string if the ref is a tag
+func (m SourceSpec) GitBranch() string {
+	if strings.HasPrefix(m.GitRef, "refs/tags/") {
+		return ""
+	}
+	return strings.TrimPrefix(m.GitRef, "refs/heads/")
+}
+
+// ShortCommit returns the abbreviated commit SHA
+func (m SourceSpec) ShortCommit() string {
+	if len(m.GitCommit) > 7 {
+		return m.GitCommit[:7]
+	}
+	return m.GitCommit
+}
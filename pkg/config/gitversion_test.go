@@ -0,0 +1,101 @@
+package config_test
+
+import (
+	"encoding/json"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/api"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestGitVersionRelease(t *testing.T) {
+	for _, tag := range []string{"v1.2.3", "1.2.3"} {
+		v, err := config.NewGitVersion(config.SourceSpec{GitTag: tag, GitCommit: "ab543b32de"})
+		assert.NoError(t, err)
+		assert.Equal(t, &config.GitVersion{AppVersion: "1.2.3", GivenVersion: "1.2.3", Snapshot: false}, v)
+	}
+}
+
+func TestGitVersionSnapshot(t *testing.T) {
+	v, err := config.NewGitVersion(config.SourceSpec{
+		GitRef:         "refs/heads/feature/AOS-123",
+		GitCommit:      "ab543b32de",
+		GitCommitCount: 42,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &config.GitVersion{
+		AppVersion:   "SNAPSHOT-feature_AOS-123-42-ab543b3",
+		GivenVersion: "feature_AOS-123-SNAPSHOT",
+		Snapshot:     true,
+	}, v)
+
+	v, err = config.NewGitVersion(config.SourceSpec{GitTag: "v1.2.3-rc1", GitCommit: "ab543b32de"})
+	assert.NoError(t, err)
+	assert.Equal(t, "SNAPSHOT-HEAD-ab543b3", v.AppVersion)
+	assert.True(t, v.Snapshot)
+}
+
+func TestGitVersionWithoutRevision(t *testing.T) {
+	_, err := config.NewGitVersion(config.SourceSpec{GitRef: "master"})
+	assert.Error(t, err)
+}
+
+func TestGitVersionConfig(t *testing.T) {
+	c, err := config.NewFileConfigReader("../../testdata/build-git.json").ReadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, config.GitVersionSource, c.ApplicationSpec.VersionSource)
+	assert.Equal(t, "feature_AOS-123-SNAPSHOT", c.ApplicationSpec.MavenGav.Version)
+	assert.Equal(t, config.SourceSpec{
+		GitUri:         "https://git.themoon.com/groupid/app.git",
+		GitRef:         "feature/AOS-123",
+		GitCommit:      "ab543b32de1f2c9a2c1b0b26ba76b2a8a1f6d4c0",
+		GitCommitCount: 42,
+	}, c.SourceSpec)
+}
+
+// readGitBuild reads testdata/build-git.json changed by edit
+func readGitBuild(t *testing.T, edit func(build *api.Build)) (*config.Config, error) {
+	data, err := ioutil.ReadFile("../../testdata/build-git.json")
+	assert.NoError(t, err)
+	build := api.Build{}
+	assert.NoError(t, json.Unmarshal(data, &build))
+	edit(&build)
+	data, err = json.Marshal(build)
+	assert.NoError(t, err)
+	file, err := ioutil.TempFile("", "build-git")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	assert.NoError(t, err)
+	file.Close()
+	return config.NewFileConfigReader(file.Name()).ReadConfig()
+}
+
+func TestGitVersionConfigRequiresBinaryBuild(t *testing.T) {
+	_, err := readGitBuild(t, func(build *api.Build) {
+		build.Spec.Source = api.BuildSource{
+			Type: api.BuildSourceGit,
+			Git:  &api.GitBuildSource{URI: "https://git.themoon.com/groupid/app.git", Ref: "feature/AOS-123"},
+		}
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "VERSION_SOURCE git requires a binary build")
+}
+
+func TestGitVersionConfigWithoutMavenCoordinates(t *testing.T) {
+	c, err := readGitBuild(t, func(build *api.Build) {
+		env := make([]api.EnvVar, 0)
+		for _, e := range build.Spec.Strategy.CustomStrategy.Env {
+			if e.Name != "ARTIFACT_ID" && e.Name != "GROUP_ID" {
+				env = append(env, e)
+			}
+		}
+		build.Spec.Strategy.CustomStrategy.Env = env
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "app", c.ApplicationSpec.MavenGav.ArtifactId)
+	assert.Equal(t, "", c.ApplicationSpec.MavenGav.GroupId)
+	assert.True(t, c.BinaryBuild)
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type OutputMode string
+
+const (
+	// The build fails if the image is not pushed to every target
+	AtomicOutput OutputMode = "atomic"
+	// The build fails only if the image is not pushed to the output registry
+	BestEffortOutput OutputMode = "best-effort"
+)
+
+// OutputTarget is a registry the image is pushed to in addition to the output registry, e.g. for disaster recovery.
+//
+// Example:
+//
+//	[{"registry": "dr-registry.aurora.sits.no:5000", "credentialsFile": "/u01/dr-secret/.dockercfg",
+//	  "tagPolicy": {"rules": [{"type": "major"}, {"type": "latest"}]}}]
+type OutputTarget struct {
+	Registry string `json:"registry"`
+	// Defaults to the output repository
+	Repository string `json:"repository,omitempty"`
+	// Defaults to the tag policy of the build
+	TagPolicy *TagPolicy `json:"tagPolicy,omitempty"`
+	// Docker config with the credentials for the registry. The registry credentials of the build are used if empty
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+}
+
+// ParseOutputTargets reads a JSON list of output targets
+func ParseOutputTargets(data []byte) ([]OutputTarget, error) {
+	targets := make([]OutputTarget, 0)
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal output targets")
+	}
+	for i, target := range targets {
+		if strings.TrimSpace(target.Registry) == "" {
+			return nil, errors.Errorf("Output target %d requires a registry", i)
+		}
+		if target.TagPolicy != nil {
+			if err := target.TagPolicy.validate(); err != nil {
+				return nil, errors.Wrapf(err, "Invalid tag policy for output target %s", target.Registry)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// ParseOutputMode parses atomic or best-effort. Defaults to atomic.
+func ParseOutputMode(mode string) (OutputMode, error) {
+	switch OutputMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", AtomicOutput:
+		return AtomicOutput, nil
+	case BestEffortOutput:
+		return BestEffortOutput, nil
+	}
+	return "", errors.Errorf("Unknown output mode %s. Expected %s or %s", mode, AtomicOutput, BestEffortOutput)
+}
+
+// ForOutputTarget returns a copy of the config where the output registry, repository and tag policy are those of
+// the target
+func (m *Config) ForOutputTarget(target OutputTarget) *Config {
+	cfg := *m
+	cfg.DockerSpec.OutputRegistry = target.Registry
+	if target.Repository != "" {
+		cfg.DockerSpec.OutputRepository = target.Repository
+	}
+	if target.TagPolicy != nil {
+		cfg.DockerSpec.TagPolicy = target.TagPolicy
+	}
+	cfg.DockerSpec.OutputTargets = nil
+	return &cfg
+}
+
+// OutputConfigs returns the config of each place the image is pushed to, in the order they are pushed. In atomic
+// mode the output registry is last, so that it is not updated if the push to another target fails.
+func (m *Config) OutputConfigs() []*Config {
+	configs := make([]*Config, 0, len(m.DockerSpec.OutputTargets)+1)
+	if m.DockerSpec.OutputMode == BestEffortOutput {
+		configs = append(configs, m)
+	}
+	for _, target := range m.DockerSpec.OutputTargets {
+		configs = append(configs, m.ForOutputTarget(target))
+	}
+	if m.DockerSpec.OutputMode != BestEffortOutput {
+		configs = append(configs, m)
+	}
+	return configs
+}
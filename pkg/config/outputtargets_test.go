@@ -0,0 +1,65 @@
+package config_test
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseOutputTargets(t *testing.T) {
+	targets, err := config.ParseOutputTargets([]byte(`[
+		{"registry": "dr-registry.aurora.sits.no:5000", "credentialsFile": "/u01/dr-secret/.dockercfg"},
+		{"registry": "registry.partner.no", "repository": "partner/console", "tagPolicy": {"rules": [{"type": "major"}]}}
+	]`))
+	assert.NoError(t, err)
+	assert.Len(t, targets, 2)
+	assert.Equal(t, "/u01/dr-secret/.dockercfg", targets[0].CredentialsFile)
+	assert.Nil(t, targets[0].TagPolicy)
+	assert.Equal(t, "partner/console", targets[1].Repository)
+	assert.NotNil(t, targets[1].TagPolicy)
+}
+
+func TestParseOutputTargetsValidation(t *testing.T) {
+	_, err := config.ParseOutputTargets([]byte(`[{"repository": "aurora/console"}]`))
+	assert.Error(t, err)
+	_, err = config.ParseOutputTargets([]byte(`[{"registry": "registry.partner.no", "tagPolicy": {"rules": [{"type": "nightly"}]}}]`))
+	assert.Error(t, err)
+}
+
+func TestParseOutputMode(t *testing.T) {
+	mode, err := config.ParseOutputMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, config.AtomicOutput, mode)
+	mode, err = config.ParseOutputMode("Best-Effort")
+	assert.NoError(t, err)
+	assert.Equal(t, config.BestEffortOutput, mode)
+	_, err = config.ParseOutputMode("all")
+	assert.Error(t, err)
+}
+
+func TestOutputConfigs(t *testing.T) {
+	policy := &config.TagPolicy{}
+	cfg := &config.Config{DockerSpec: config.DockerSpec{
+		OutputRegistry:   "registry.aurora.sits.no:5000",
+		OutputRepository: "aurora/console",
+		OutputTargets: []config.OutputTarget{
+			{Registry: "dr-registry.aurora.sits.no:5000"},
+			{Registry: "registry.partner.no", Repository: "partner/console", TagPolicy: policy},
+		},
+	}}
+
+	configs := cfg.OutputConfigs()
+	assert.Len(t, configs, 3)
+	assert.Equal(t, "dr-registry.aurora.sits.no:5000", configs[0].DockerSpec.OutputRegistry)
+	assert.Equal(t, "aurora/console", configs[0].DockerSpec.OutputRepository)
+	assert.Nil(t, configs[0].DockerSpec.OutputTargets)
+	assert.Equal(t, "partner/console", configs[1].DockerSpec.OutputRepository)
+	assert.Equal(t, policy, configs[1].DockerSpec.TagPolicy)
+	assert.Equal(t, cfg, configs[2])
+	assert.Len(t, cfg.DockerSpec.OutputTargets, 2)
+
+	cfg.DockerSpec.OutputMode = config.BestEffortOutput
+	configs = cfg.OutputConfigs()
+	assert.Equal(t, cfg, configs[0])
+	assert.Equal(t, "registry.partner.no", configs[2].DockerSpec.OutputRegistry)
+}
@@ -16,13 +16,21 @@ type DockerImage struct {
 	Tag        string
 	Repository string
 	Registry   string
+	//Set to use the image of one platform in a manifest list. The tag is kept for the aurora version
+	Digest string
+	//Set when the base image is deprecated, and recorded in a label of the images built on it
+	Deprecated string
 }
 
 func (m *DockerImage) GetCompleteDockerTagName() string {
+	reference := ":" + m.Tag
+	if m.Digest != "" {
+		reference = "@" + m.Digest
+	}
 	if m.Registry == "" {
-		return m.Repository + ":" + m.Tag
+		return m.Repository + reference
 	} else {
-		return m.Registry + "/" + m.Repository + ":" + m.Tag
+		return m.Registry + "/" + m.Repository + reference
 	}
 }
 
@@ -201,6 +209,16 @@ func (m *AuroraVersion) GetApplicationVersionTagsToPush(repositoryTags []string,
 	return versions, nil
 }
 
+// HasNewerRelease tells if the repository has a release with a higher version than this release. Tags that
+// point to the newest release are not moved by an older release, like a hotfix of a previous major version.
+// The repository tags must be versions, as for GetApplicationVersionTagsToPush.
+func (m *AuroraVersion) HasNewerRelease(repositoryTags []string) (bool, error) {
+	if !m.isSemanticReleaseVersion() {
+		return false, nil
+	}
+	return tagCompare("> "+string(m.appVersion), repositoryTags)
+}
+
 func tagCompare(versionConstraint string, tags []string) (bool, error) {
 	c, err := extVersion.NewConstraint(versionConstraint)
 
@@ -224,6 +242,30 @@ func tagCompare(versionConstraint string, tags []string) (bool, error) {
 	return false, nil
 }
 
+// FindHighestVersion returns the highest of the tags that satisfies the version constraint, or an empty string if
+// none does. Tags that are not versions are ignored. Of equal versions, like 1.2 and 1.2.0, the most specific tag is
+// chosen, as the shorter tags are moved by new releases.
+func FindHighestVersion(versionConstraint string, tags []string) (string, error) {
+	c, err := extVersion.NewConstraint(versionConstraint)
+	if err != nil {
+		return "", errors.Wrapf(err, "Could not create version constraint %s", versionConstraint)
+	}
+
+	var highest *extVersion.Version
+	highestTag := ""
+	for _, tag := range tags {
+		v, err := extVersion.NewVersion(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if highest == nil || v.Compare(highest) > 0 || (v.Compare(highest) == 0 && len(tag) > len(highestTag)) {
+			highest = v
+			highestTag = tag
+		}
+	}
+	return highestTag, nil
+}
+
 func getMajor(version string, bumpVersion bool) (string, error) {
 	build_version, err := extVersion.NewVersion(version)
 
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+)
+
+type TagRuleType string
+
+const (
+	LatestTagRule   TagRuleType = "latest"
+	MajorTagRule    TagRuleType = "major"
+	MinorTagRule    TagRuleType = "minor"
+	PatchTagRule    TagRuleType = "patch"
+	BranchTagRule   TagRuleType = "branch"
+	DateTagRule     TagRuleType = "date"
+	ChannelTagRule  TagRuleType = "channel"
+	GitShaTagRule   TagRuleType = "gitsha"
+	StaticTagRule   TagRuleType = "static"
+	SnapshotTagRule TagRuleType = "snapshot"
+)
+
+type TagRuleCondition string
+
+const (
+	Always       TagRuleCondition = "always"
+	ReleaseOnly  TagRuleCondition = "release"
+	SnapshotOnly TagRuleCondition = "snapshot"
+)
+
+// TagPolicy describes which extra tags to push in addition to the complete (aurora) version tag.
+// The rules are evaluated in order by the PolicyTagResolver. The policy may also be given in YAML.
+//
+// Example:
+//
+//	{"rules": [
+//	  {"type": "major"}, {"type": "minor"}, {"type": "patch"}, {"type": "latest"},
+//	  {"type": "channel", "name": "stable", "when": "release"},
+//	  {"type": "channel", "name": "edge", "when": "snapshot"},
+//	  {"type": "date", "format": "20060102", "prefix": "build-"},
+//	  {"type": "gitsha"}
+//	]}
+type TagPolicy struct {
+	Rules []TagRule `json:"rules"`
+}
+
+type TagRule struct {
+	Type TagRuleType `json:"type"`
+	// Name is the tag to push for channel and static rules
+	Name string `json:"name,omitempty"`
+	// Format is the time layout used by date rules. Defaults to 20060102
+	Format string `json:"format,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// When restricts the rule to release or snapshot builds. Defaults to always
+	When TagRuleCondition `json:"when,omitempty"`
+}
+
+// Applies returns true if the rule should be evaluated for a build of the given kind
+func (m TagRule) Applies(snapshot bool) bool {
+	switch m.When {
+	case ReleaseOnly:
+		return !snapshot
+	case SnapshotOnly:
+		return snapshot
+	default:
+		return true
+	}
+}
+
+// SemanticExtraTags returns the semantic version tags requested by the policy, in the form
+// understood by AuroraVersion
+func (m *TagPolicy) SemanticExtraTags() PushExtraTags {
+	p := PushExtraTags{}
+	for _, rule := range m.Rules {
+		switch rule.Type {
+		case LatestTagRule:
+			p.Latest = true
+		case MajorTagRule:
+			p.Major = true
+		case MinorTagRule:
+			p.Minor = true
+		case PatchTagRule:
+			p.Patch = true
+		}
+	}
+	return p
+}
+
+func (m *TagPolicy) validate() error {
+	for i, rule := range m.Rules {
+		switch rule.Type {
+		case LatestTagRule, MajorTagRule, MinorTagRule, PatchTagRule,
+			BranchTagRule, DateTagRule, GitShaTagRule, SnapshotTagRule:
+		case ChannelTagRule, StaticTagRule:
+			if strings.TrimSpace(rule.Name) == "" {
+				return errors.Errorf("Tag policy rule %d of type %s requires a name", i, rule.Type)
+			}
+		default:
+			return errors.Errorf("Tag policy rule %d has unknown type %q", i, rule.Type)
+		}
+		switch rule.When {
+		case "", Always, ReleaseOnly, SnapshotOnly:
+		default:
+			return errors.Errorf("Tag policy rule %d has unknown condition %q", i, rule.When)
+		}
+	}
+	return nil
+}
+
+// ParseTagPolicy reads a tag policy in JSON or YAML. YAML is converted to JSON, so both have the same field names.
+func ParseTagPolicy(data []byte) (*TagPolicy, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] != '{' {
+		converted, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to convert tag policy from YAML")
+		}
+		data = converted
+	}
+	policy := &TagPolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal tag policy")
+	}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// ReadTagPolicyFile reads a JSON or YAML tag policy from file
+func ReadTagPolicyFile(path string) (*TagPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read tag policy file %s", path)
+	}
+	return ParseTagPolicy(data)
+}
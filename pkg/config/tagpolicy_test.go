@@ -0,0 +1,48 @@
+package config_test
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTagPolicy(t *testing.T) {
+	policy, err := config.ParseTagPolicy([]byte(`{"rules": [
+		{"type": "major"},
+		{"type": "latest"},
+		{"type": "channel", "name": "stable", "when": "release"},
+		{"type": "date", "format": "20060102", "prefix": "build-"}
+	]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(policy.Rules))
+	assert.Equal(t, config.PushExtraTags{Latest: true, Major: true}, policy.SemanticExtraTags())
+	assert.True(t, policy.Rules[2].Applies(false))
+	assert.False(t, policy.Rules[2].Applies(true))
+	assert.True(t, policy.Rules[3].Applies(true))
+}
+
+func TestParseTagPolicyValidation(t *testing.T) {
+	_, err := config.ParseTagPolicy([]byte(`{"rules": [{"type": "nightly"}]}`))
+	assert.Error(t, err)
+	_, err = config.ParseTagPolicy([]byte(`{"rules": [{"type": "channel"}]}`))
+	assert.Error(t, err)
+	_, err = config.ParseTagPolicy([]byte(`{"rules": [{"type": "latest", "when": "sometimes"}]}`))
+	assert.Error(t, err)
+}
+
+func TestParseTagPolicyYaml(t *testing.T) {
+	policy, err := config.ParseTagPolicy([]byte(`rules:
+  - type: major
+  - type: channel
+    name: stable
+    when: release
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []config.TagRule{
+		{Type: config.MajorTagRule},
+		{Type: config.ChannelTagRule, Name: "stable", When: config.ReleaseOnly},
+	}, policy.Rules)
+
+	_, err = config.ParseTagPolicy([]byte("rules:\n  - type: nightly\n"))
+	assert.Error(t, err)
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/util"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type ApplicationType string
@@ -26,16 +30,27 @@ const (
 )
 
 type Config struct {
-	ApplicationType ApplicationType
-	ApplicationSpec ApplicationSpec
-	DockerSpec      DockerSpec
-	BuilderSpec     BuilderSpec
-	BinaryBuild     bool
+	ApplicationType   ApplicationType
+	ApplicationSpec   ApplicationSpec
+	DockerSpec        DockerSpec
+	BuilderSpec       BuilderSpec
+	SourceSpec        SourceSpec
+	BuildMetadata     BuildMetadata
+	SigningSpec       SigningSpec
+	VulnerabilitySpec VulnerabilitySpec
+	TimeoutSpec       TimeoutSpec
+	RetrySpec         RetrySpec
+	MetricsSpec       MetricsSpec
+	TracingSpec       TracingSpec
+	BinaryBuild       bool
+	//Max number of images built, and tags pushed, at the same time. Zero uses the default
+	Concurrency int
 }
 
 type ApplicationSpec struct {
 	MavenGav      MavenGav
 	BaseImageSpec DockerBaseImageSpec
+	VersionSource VersionSource
 }
 
 type MavenGav struct {
@@ -55,8 +70,23 @@ func (m *MavenGav) Name() string {
 }
 
 type DockerBaseImageSpec struct {
-	BaseImage   string
+	BaseImage string
+	// A tag, a digest or a version constraint like ~> 1.2 or >= 8, < 9
 	BaseVersion string
+	//Restricts which base images may be used. Deprecated base images are only warned about if nil
+	Policy *BaseImagePolicy
+}
+
+// IsVersionConstraint tells if the base version is a constraint to be resolved against the tags of the
+// base image, rather than a tag or digest
+func (m DockerBaseImageSpec) IsVersionConstraint() bool {
+	version := strings.TrimSpace(m.BaseVersion)
+	for _, operator := range []string{"~>", ">", "<", "=", "!="} {
+		if strings.HasPrefix(version, operator) {
+			return true
+		}
+	}
+	return false
 }
 
 type DockerSpec struct {
@@ -65,16 +95,100 @@ type DockerSpec struct {
 	PushExtraTags    PushExtraTags
 	//This is the external docker registry where we check versions.
 	ExternalDockerRegistry string
+	//Registries to use for base images, in order, when the external registry is not available
+	ExternalDockerRegistryMirrors []string
 	//The tag to push to. This is only used for ImageStreamTags (as for now) and RETAG functionality
 	TagWith      string
 	RetagWith    string
 	TagOverwrite bool
+	//Declarative tag policy. If set, this is used instead of PushExtraTags when resolving tags
+	TagPolicy *TagPolicy
+	//Platforms to build for, e.g. linux/amd64, when the base image is a manifest list
+	Platforms []string
+	//Registries the image is pushed to in addition to the output registry
+	OutputTargets []OutputTarget
+	//Whether a failed push to one of the output targets fails the build
+	OutputMode OutputMode
 }
 
 type BuilderSpec struct {
 	Version string
 }
 
+// Information about the OpenShift build running architect
+type BuildMetadata struct {
+	Name            string
+	Namespace       string
+	BuildConfigName string
+	BuildNumber     string
+	BuilderImage    string
+}
+
+// Information about the source revision that triggered the build, if any
+type SourceSpec struct {
+	GitUri    string
+	GitRef    string
+	GitCommit string
+	GitTag    string
+	//Number of commits reachable from GitCommit. 0 if unknown
+	GitCommitCount int
+}
+
+// Signing of pushed images. Images are not signed if KeyFile is empty
+type SigningSpec struct {
+	KeyFile string
+	//File with the password of an encrypted key. If empty, COSIGN_PASSWORD is used
+	PasswordFile string
+}
+
+// Check of the dependencies in the deliverable against a database of known vulnerabilities.
+// The check is skipped if DatabaseFile is empty
+type VulnerabilitySpec struct {
+	DatabaseFile string
+	//Lowest severity that fails the build. Defaults to HIGH
+	FailSeverity string
+	//Lowest severity that is reported as a warning. Defaults to LOW
+	WarnSeverity string
+}
+
+// Timeouts for the phases of the build. Zero means no timeout
+type TimeoutSpec struct {
+	//Download of the deliverable from Nexus
+	Download time.Duration
+	//Pull of the base image and Docker build
+	Build time.Duration
+	//Tag, push and signing of the image. Also used for retag
+	Push time.Duration
+}
+
+// RetrySpec limits the retries of downloads, registry lookups, pulls and pushes. Zero values use the defaults.
+type RetrySpec struct {
+	//Number of attempts, including the first
+	Attempts int
+	//Backoff before the first retry. It is doubled for each retry, up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// RetryPolicy creates the retry policy of the build, with defaults for the values not set
+func (m RetrySpec) RetryPolicy() util.RetryPolicy {
+	policy := util.RetryPolicy{
+		Attempts:       util.DefaultRetryAttempts,
+		InitialBackoff: util.DefaultInitialBackoff,
+		MaxBackoff:     util.DefaultMaxRetryBackoff,
+	}
+	if m.Attempts > 0 {
+		policy.Attempts = m.Attempts
+	}
+	if m.InitialBackoff > 0 {
+		policy.InitialBackoff = m.InitialBackoff
+	}
+	if m.MaxBackoff > 0 {
+		policy.MaxBackoff = m.MaxBackoff
+	}
+	return policy
+}
+
 type PushExtraTags struct {
 	Latest bool
 	Major  bool
@@ -82,7 +196,8 @@ type PushExtraTags struct {
 	Patch  bool
 }
 
-// Generates the tags given the appversion and extra tag configuration. Don't do any filtering
+// Generates the tags given the appversion and extra tag configuration. Don't do any filtering.
+// The result can be read back with ParseExtraTags.
 func (m *PushExtraTags) ToStringValue() string {
 	str := make([]string, 0, 5)
 	if m.Major {
@@ -97,6 +212,9 @@ func (m *PushExtraTags) ToStringValue() string {
 	if m.Latest {
 		str = append(str, "latest")
 	}
+	if len(str) == 0 {
+		return noExtraTags
+	}
 	return strings.Join(str, ",")
 }
 
@@ -104,19 +222,50 @@ func (m DockerSpec) GetExternalRegistryWithoutProtocol() string {
 	return strings.TrimPrefix(m.ExternalDockerRegistry, "https://")
 }
 
-func ParseExtraTags(i string) PushExtraTags {
+const noExtraTags = "none"
+
+// ParseExtraTags parses a comma or whitespace separated list of extra tags, e.g. "latest,major minor".
+// Valid tags are latest, major, minor and patch. "none" explicitly disables all extra tags and can not
+// be combined with other tags. An empty string is parsed as no extra tags.
+func ParseExtraTags(i string) (PushExtraTags, error) {
 	p := PushExtraTags{}
-	if strings.Contains(i, "major") {
-		p.Major = true
+	tokens := strings.FieldsFunc(i, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, token := range tokens {
+		switch strings.ToLower(token) {
+		case "major":
+			p.Major = true
+		case "minor":
+			p.Minor = true
+		case "patch":
+			p.Patch = true
+		case "latest":
+			p.Latest = true
+		case noExtraTags:
+			if len(tokens) > 1 {
+				return p, errors.Errorf("Extra tag %s can not be combined with other tags in %q", noExtraTags, i)
+			}
+		default:
+			return p, errors.Errorf("Unknown extra tag %q in %q. Valid tags are latest, major, minor, patch and %s",
+				token, i, noExtraTags)
+		}
 	}
-	if strings.Contains(i, "minor") {
-		p.Minor = true
-	}
-	if strings.Contains(i, "patch") {
-		p.Patch = true
-	}
-	if strings.Contains(i, "latest") {
-		p.Latest = true
-	}
-	return p
+	return p, nil
+}
+
+// MetricsSpec tells where the metrics of a build are exported. Nothing is exported if both are empty.
+type MetricsSpec struct {
+	//Url of a Prometheus Pushgateway, e.g. http://pushgateway:9091
+	PushgatewayUrl string
+	//File to write the metrics to, in the Prometheus text format
+	File string
+}
+
+// TracingSpec tells where the trace of a build is exported. The build is not traced if both are empty.
+type TracingSpec struct {
+	//Base url of an OTLP/HTTP collector, e.g. http://collector:4318
+	Endpoint string
+	//File to write the spans to, in the OTLP JSON encoding
+	File string
 }
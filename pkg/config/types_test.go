@@ -0,0 +1,69 @@
+package config_test
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseExtraTags(t *testing.T) {
+	all := config.PushExtraTags{Latest: true, Major: true, Minor: true, Patch: true}
+	for _, value := range []string{"latest major minor patch", "latest,major,minor,patch", " latest, major\tminor ,patch "} {
+		p, err := config.ParseExtraTags(value)
+		assert.NoError(t, err)
+		assert.Equal(t, all, p)
+	}
+
+	p, err := config.ParseExtraTags("major")
+	assert.NoError(t, err)
+	assert.Equal(t, config.PushExtraTags{Major: true}, p)
+
+	for _, value := range []string{"", "none", "NONE"} {
+		p, err = config.ParseExtraTags(value)
+		assert.NoError(t, err)
+		assert.Equal(t, config.PushExtraTags{}, p)
+	}
+}
+
+func TestParseExtraTagsInvalid(t *testing.T) {
+	for _, value := range []string{"minor-only", "latest,lastest", "none,major"} {
+		_, err := config.ParseExtraTags(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestExtraTagsRoundTrip(t *testing.T) {
+	for _, p := range []config.PushExtraTags{
+		{},
+		{Latest: true},
+		{Major: true, Patch: true},
+		{Latest: true, Major: true, Minor: true, Patch: true},
+	} {
+		parsed, err := config.ParseExtraTags(p.ToStringValue())
+		assert.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+}
+
+func TestIsVersionConstraint(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"1":           false,
+		"1.2.3":       false,
+		"sha256:abcd": false,
+		"~> 1.2":      true,
+		">= 8, < 9":   true,
+		" != 1.2.0":   true,
+		"= 1.2":       true,
+		"<2":          true,
+	} {
+		assert.Equal(t, expected, config.DockerBaseImageSpec{BaseVersion: version}.IsVersionConstraint(), version)
+	}
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	policy := config.RetrySpec{Attempts: 5}.RetryPolicy()
+	assert.Equal(t, 5, policy.Attempts)
+	assert.Equal(t, util.DefaultInitialBackoff, policy.InitialBackoff)
+	assert.Equal(t, util.DefaultMaxRetryBackoff, policy.MaxBackoff)
+}
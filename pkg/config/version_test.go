@@ -55,7 +55,7 @@ type RegistryMock struct{}
 
 var dockerSpec = config.DockerSpec{
 	OutputRegistry:         CFG_OUTPUT_REGISTRY,
-	PushExtraTags:          config.ParseExtraTags(CFG_PUSH_EXTRA_TAGS),
+	PushExtraTags:          config.PushExtraTags{Latest: true, Major: true, Minor: true, Patch: true},
 	OutputRepository:       CFG_OUPUT_REPOSITORY,
 	ExternalDockerRegistry: CFG_EXTERNAL_REGISTRY,
 }
@@ -81,7 +81,7 @@ var mavenGavSnapshot = config.ApplicationSpec{
 
 func TestTagInfoRelease(t *testing.T) {
 	appVersion := runtime.NewAuroraVersion(APP_VERSION, false, APP_VERSION, runtime.CompleteVersion(AURORA_VERSION))
-	tags, err := appVersion.GetApplicationVersionTagsToPush(make([]string, 0), config.ParseExtraTags(CFG_PUSH_EXTRA_TAGS))
+	tags, err := appVersion.GetApplicationVersionTagsToPush(make([]string, 0), mustParseExtraTags(t, CFG_PUSH_EXTRA_TAGS))
 	if err != nil {
 		t.Fatalf("Failed to create target VersionInfo %v", err)
 	}
@@ -95,7 +95,7 @@ func TestTagInfoRelease(t *testing.T) {
 
 func TestTagInfoSnapshot(t *testing.T) {
 	appVersion := runtime.NewAuroraVersion(SNAPSHOT_APP_VERSION, true, SNAPSHOT_GIVEN_VERSION, runtime.CompleteVersion(SNAPSHOT_AURORA_VERSION))
-	tags, err := appVersion.GetApplicationVersionTagsToPush([]string{}, config.ParseExtraTags(CFG_PUSH_EXTRA_TAGS))
+	tags, err := appVersion.GetApplicationVersionTagsToPush([]string{}, mustParseExtraTags(t, CFG_PUSH_EXTRA_TAGS))
 	if err != nil {
 		t.Fatalf("Failed to create target VersionInfo %v", err)
 	}
@@ -190,6 +190,29 @@ func TestFilterTags(t *testing.T) {
 		[]string{"2.0.1", "2.0", "2", "latest"})
 }
 
+func TestFindHighestVersion(t *testing.T) {
+	tags := []string{"latest", "1", "1.1", "1.1.2", "1.2", "1.2.0", "1.2.3", "1.3.0-rc1", "2.0.0", "8.0.1", "8.4", "9.0.0"}
+	for constraint, expected := range map[string]string{
+		"~> 1.2":    "1.2.3",
+		"~> 1.1.0":  "1.1.2",
+		">= 8, < 9": "8.4",
+		"= 1.2":     "1.2.0",
+		"> 9":       "",
+	} {
+		actual, err := runtime.FindHighestVersion(constraint, tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("Expected %s to resolve to %q, got %q", constraint, expected, actual)
+		}
+	}
+
+	if _, err := runtime.FindHighestVersion("~> one", tags); err == nil {
+		t.Error("Expected error for invalid constraint")
+	}
+}
+
 type repositoryTester struct {
 	t                *testing.T
 	tagsFromRegistry []string
@@ -198,7 +221,7 @@ type repositoryTester struct {
 //TODO: We don't filter tags, we return the tags we need... Need to refactor test!
 func (m repositoryTester) testTagFiltering(appVersion string, candidateTags []string, excpectedFilteringResult []string) {
 	a := runtime.NewAuroraVersion(appVersion, false, appVersion, runtime.CompleteVersion(AURORA_VERSION))
-	_, err := a.GetApplicationVersionTagsToPush(m.tagsFromRegistry, config.ParseExtraTags("lastest major minor patch"))
+	_, err := a.GetApplicationVersionTagsToPush(m.tagsFromRegistry, mustParseExtraTags(m.t, "latest major minor patch"))
 
 	if err != nil {
 		m.t.Fatalf("Failed to call FilterTags %v", err)
@@ -225,6 +248,14 @@ func (registry RegistryMock) GetManifestEnv(repository string, tag string, name
 	}
 }
 
+func mustParseExtraTags(t *testing.T, extraTags string) config.PushExtraTags {
+	p, err := config.ParseExtraTags(extraTags)
+	if err != nil {
+		t.Fatalf("Failed to parse extra tags %v", err)
+	}
+	return p
+}
+
 func verifyTagListContent(actualList []string, expectedList []string, t *testing.T) {
 	if len(actualList) != len(expectedList) {
 		t.Errorf("Expected %v tags, actual is %v", expectedList, actualList)
@@ -1,45 +1,69 @@
 package docker
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"github.com/pkg/errors"
 	"io"
 	"io/ioutil"
+	"os/exec"
 	"strings"
 )
 
+// Credential helpers return this user name when the secret is an identity token
+const tokenUsername = "<token>"
+
 type DockerConfig struct {
 	Auths       Auths             `json:"auths"`
 	HttpHeaders map[string]string `json:"HttpHeaders,omitempty"`
+	// Credential helper for all registries, e.g. secretservice for docker-credential-secretservice
+	CredsStore string `json:"credsStore,omitempty"`
+	// Credential helpers by registry. Takes precedence over CredsStore
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
 }
 
 type Auths map[string]RegistryEntry
 
 type RegistryEntry struct {
-	Email string `json:"email,omitempty"`
-	Auth  string `json:"auth,omitempty"`
+	Email         string `json:"email,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
 }
 
 type Credentials struct {
 	User     string
 	Password string
+	// Refresh token for the token server of the registry, used instead of the password
+	IdentityToken string
+	// Bearer token for the registry
+	RegistryToken string
 }
 
+// ReadConfig reads a config.json, or a .dockercfg in the legacy format where the registries are at the top level
 func ReadConfig(reader io.Reader) (*DockerConfig, error) {
-	var cfg *DockerConfig
-
 	content, err := ioutil.ReadAll(reader)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if err = json.Unmarshal(content, &cfg); err != nil {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(content, &keys); err != nil {
 		return nil, errors.Wrap(err, "Failed to unmarshal Docker config json")
 	}
 
-	if len(cfg.Auths) > 0 {
+	cfg := &DockerConfig{}
+	_, hasAuths := keys["auths"]
+	_, hasCredsStore := keys["credsStore"]
+	_, hasCredHelpers := keys["credHelpers"]
+	if hasAuths || hasCredsStore || hasCredHelpers {
+		if err := json.Unmarshal(content, cfg); err != nil {
+			return nil, errors.Wrap(err, "Failed to unmarshal Docker config json")
+		}
 		return cfg, nil
 	}
 
@@ -50,24 +74,125 @@ func ReadConfig(reader io.Reader) (*DockerConfig, error) {
 	return cfg, nil
 }
 
+// NormalizeRegistry gives the host of a registry address, so that e.g. https://host:5000/v1/ and host:5000 are
+// the same registry. Docker Hub has several names, which are all index.docker.io.
+func NormalizeRegistry(address string) string {
+	host := strings.ToLower(address)
+	for _, scheme := range []string{"https://", "http://"} {
+		host = strings.TrimPrefix(host, scheme)
+	}
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		return "index.docker.io"
+	}
+	return host
+}
+
+// The credential helpers store credentials by the address given to docker login, which is the host of the
+// registry, except for Docker Hub
+func helperServerURL(registry string) string {
+	if registry == "index.docker.io" {
+		return "https://index.docker.io/v1/"
+	}
+	return registry
+}
+
+// GetCredentials returns the credentials for the registry, or nil if there are none. A credential helper
+// configured for the registry, or as the store for all registries, is asked before the auths in the config.
 func (cfg DockerConfig) GetCredentials(address string) (*Credentials, error) {
-	regEntry, ok := cfg.Auths[address]
+	registry := NormalizeRegistry(address)
+
+	helper := cfg.CredsStore
+	if registryHelper, ok := cfg.CredHelpers[address]; ok {
+		helper = registryHelper
+	} else {
+		for key, registryHelper := range cfg.CredHelpers {
+			if NormalizeRegistry(key) == registry {
+				helper = registryHelper
+				break
+			}
+		}
+	}
+	if helper != "" {
+		credentials, err := getHelperCredentials(helper, helperServerURL(registry))
+		if err != nil || credentials != nil {
+			return credentials, err
+		}
+	}
 
-	if !ok || regEntry.Auth == "" {
+	regEntry, ok := cfg.Auths[address]
+	if !ok {
+		for key, entry := range cfg.Auths {
+			if NormalizeRegistry(key) == registry {
+				regEntry, ok = entry, true
+				break
+			}
+		}
+	}
+	if !ok {
 		return nil, nil
 	}
 
-	auth, err := base64.StdEncoding.DecodeString(regEntry.Auth)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to base64 decode credentials from Docker config for server %s", address)
+	credentials := &Credentials{
+		User:          regEntry.Username,
+		Password:      regEntry.Password,
+		IdentityToken: regEntry.IdentityToken,
+		RegistryToken: regEntry.RegistryToken,
 	}
+	if regEntry.Auth != "" {
+		auth, err := base64.StdEncoding.DecodeString(regEntry.Auth)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to base64 decode credentials from Docker config for server %s", address)
+		}
+
+		// The password may contain colons, the user name may not
+		creds := strings.SplitN(string(auth), ":", 2)
 
-	creds := strings.Split(string(auth), ":")
+		if len(creds) != 2 {
+			return nil, errors.Errorf("Failed to extract username and password from Docker config for server %s", address)
+		}
+		credentials.User = strings.TrimSpace(creds[0])
+		credentials.Password = strings.TrimSpace(creds[1])
+	}
+	if credentials.User == "" && credentials.Password == "" && credentials.IdentityToken == "" &&
+		credentials.RegistryToken == "" {
+		return nil, nil
+	}
+	return credentials, nil
+}
 
-	if len(creds) != 2 {
-		return nil, errors.Errorf("Failed to extract username and password from Docker config for server %s", address)
+// getHelperCredentials runs docker-credential-<helper> get, see https://github.com/docker/docker-credential-helpers.
+// Returns nil if the helper has no credentials for the registry.
+func getHelperCredentials(helper string, address string) (*Credentials, error) {
+	program := "docker-credential-" + helper
+	cmd := exec.Command(program, "get")
+	cmd.Stdin = strings.NewReader(address)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// The message is written to stdout by the helpers
+		message := strings.TrimSpace(stdout.String() + " " + stderr.String())
+		if strings.Contains(message, "credentials not found") {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "Credential helper %s failed for %s: %s", program, address, message)
 	}
 
-	return &Credentials{User: strings.TrimSpace(creds[0]), Password: strings.TrimSpace(creds[1])}, nil
+	response := struct {
+		ServerURL string
+		Username  string
+		Secret    string
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal credentials from %s", program)
+	}
+	if response.Username == tokenUsername {
+		return &Credentials{IdentityToken: response.Secret}, nil
+	}
+	return &Credentials{User: response.Username, Password: response.Secret}, nil
 }
@@ -1,7 +1,12 @@
 package docker_test
 
 import (
+	"encoding/base64"
 	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -153,3 +158,106 @@ func TestMultipleCredentialsInOldFormat(t *testing.T) {
 	}
 
 }
+
+func TestGetCredentialsWithColonInPassword(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("foo:bar:pw"))
+	cfg, err := docker.ReadConfig(strings.NewReader(`{"auths": {"the-registry": {"auth": "` + auth + `"}}}`))
+	assert.NoError(t, err)
+
+	cred, err := cfg.GetCredentials("the-registry")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.Credentials{User: "foo", Password: "bar:pw"}, cred)
+}
+
+func TestGetCredentialsNormalizesRegistry(t *testing.T) {
+	cfg, err := docker.ReadConfig(strings.NewReader(`{
+	"auths": {
+		"https://registry.aurora.no:5000/v1/": {"auth": "Zm9vOmJhcnB3Cg=="},
+		"https://index.docker.io/v1/": {"identitytoken": "refresh"}
+	}
+}`))
+	assert.NoError(t, err)
+
+	cred, err := cfg.GetCredentials("registry.aurora.no:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.Credentials{User: "foo", Password: "barpw"}, cred)
+
+	cred, err = cfg.GetCredentials("docker.io")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.Credentials{IdentityToken: "refresh"}, cred)
+
+	cred, err = cfg.GetCredentials("other-registry")
+	assert.NoError(t, err)
+	assert.Nil(t, cred)
+
+	assert.Equal(t, "registry.aurora.no:5000", docker.NormalizeRegistry("HTTPS://Registry.Aurora.no:5000/v2/"))
+}
+
+// The helper answers for the registries in its arguments, and writes what it was asked into asked.txt
+func writeCredentialHelper(t *testing.T, dir string, name string, response string) {
+	script := "#!/bin/sh\n" +
+		"read registry\n" +
+		"echo \"$1 $registry\" >> " + filepath.Join(dir, "asked.txt") + "\n" +
+		"case \"$registry\" in\n" +
+		"  *aurora*) echo '" + response + "' ;;\n" +
+		"  *) echo 'credentials not found in native keychain'; exit 1 ;;\n" +
+		"esac\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-"+name), []byte(script), 0755)
+	assert.NoError(t, err)
+}
+
+func TestGetCredentialsFromCredentialHelpers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credential-helpers")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeCredentialHelper(t, dir, "store", `{"ServerURL": "registry.aurora.no", "Username": "foo", "Secret": "bar:pw"}`)
+	writeCredentialHelper(t, dir, "ecr", `{"ServerURL": "ecr.aurora.no", "Username": "<token>", "Secret": "refresh"}`)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	cfg, err := docker.ReadConfig(strings.NewReader(`{
+	"credsStore": "store",
+	"credHelpers": {"https://ecr.aurora.no": "store", "ecr.aurora.no": "ecr"},
+	"auths": {"docker.io": {"auth": "Zm9vOmJhcnB3Cg=="}}
+}`))
+	assert.NoError(t, err)
+
+	cred, err := cfg.GetCredentials("https://registry.aurora.no/v2/")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.Credentials{User: "foo", Password: "bar:pw"}, cred)
+
+	cred, err = cfg.GetCredentials("ecr.aurora.no")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.Credentials{IdentityToken: "refresh"}, cred)
+
+	// Not found in the store, so the auths are used
+	cred, err = cfg.GetCredentials("docker.io")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.Credentials{User: "foo", Password: "barpw"}, cred)
+
+	asked, err := ioutil.ReadFile(filepath.Join(dir, "asked.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "get registry.aurora.no\nget ecr.aurora.no\nget https://index.docker.io/v1/\n", string(asked))
+}
+
+func TestLocalRegistryCredentialsFromDockerConfigEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	auth := base64.StdEncoding.EncodeToString([]byte("foo:bar:pw"))
+	err = ioutil.WriteFile(filepath.Join(dir, "config.json"),
+		[]byte(`{"auths": {"https://registry.aurora.no:5000": {"auth": "`+auth+`"}}}`), 0600)
+	assert.NoError(t, err)
+	dockerConfig := os.Getenv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Setenv("DOCKER_CONFIG", dockerConfig)
+
+	path, err := docker.GetDockerConfigPath()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "config.json"), path)
+
+	cred, err := docker.LocalRegistryCredentials()("registry.aurora.no:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.RegistryCredentials{Username: "foo", Password: "bar:pw", Serveraddress: "registry.aurora.no:5000"}, cred)
+}
@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"os"
+	"strings"
+)
+
+// Base images declare the version of the contract they implement, and the paths they provide as a comma
+// separated list. The paths can not be checked without pulling the image, so they must be declared.
+const (
+	LABEL_CONTRACT       = "architect.contract"
+	LABEL_CONTRACT_PATHS = "architect.contract.paths"
+)
+
+// BaseImageContract is what the Dockerfile of an application type expects of the base image
+type BaseImageContract struct {
+	// Supported versions of the contract label
+	Versions []string
+	// Env variables that must be set in the base image
+	Env []string
+	// Paths that must be declared by the base image. Env variables are expanded with the env of the base image
+	Paths []string
+}
+
+// NewBaseImageContract returns the contract of the base images of the application type
+func NewBaseImageContract(applicationType config.ApplicationType) BaseImageContract {
+	if applicationType == config.NodeJsLeveransepakke {
+		return BaseImageContract{
+			Versions: []string{"1"},
+			Env:      []string{"HOME"},
+			Paths:    []string{"/u01/bin/run_node", "/etc/nginx/mime.types"},
+		}
+	}
+	return BaseImageContract{
+		Versions: []string{"1"},
+		Env:      []string{"HOME", "TRUST_STORE"},
+		Paths:    []string{"$HOME/logs"},
+	}
+}
+
+// Verify checks the config of the base image against the contract, and returns an error with every violation.
+// Base images that do not declare a contract version are only checked for env, so that older base images
+// can still be used.
+func (m BaseImageContract) Verify(image string, imageConfig *ImageConfig) error {
+	env := imageConfig.EnvMap()
+	violations := make([]string, 0)
+	for _, name := range m.Env {
+		if _, ok := env[name]; !ok {
+			violations = append(violations, fmt.Sprintf("env %s is not set", name))
+		}
+	}
+
+	version, ok := imageConfig.Labels[LABEL_CONTRACT]
+	if !ok {
+		logrus.Warnf("Base image %s does not declare the label %s. Only its env is verified", image, LABEL_CONTRACT)
+	} else {
+		if !containsString(m.Versions, version) {
+			violations = append(violations, fmt.Sprintf("contract version %s is not supported, expected one of %s",
+				version, strings.Join(m.Versions, ", ")))
+		}
+		declared := make([]string, 0)
+		for _, path := range strings.Split(imageConfig.Labels[LABEL_CONTRACT_PATHS], ",") {
+			declared = append(declared, strings.TrimSpace(path))
+		}
+		for _, path := range m.Paths {
+			expanded := os.Expand(path, func(name string) string {
+				return env[name]
+			})
+			if !containsString(declared, expanded) {
+				violations = append(violations, fmt.Sprintf("path %s is not declared in %s", expanded, LABEL_CONTRACT_PATHS))
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return errors.Errorf("Base image %s does not satisfy the contract of the Architect build: %s", image,
+			strings.Join(violations, "; "))
+	}
+	logrus.Debugf("Base image %s satisfies contract version %s", image, version)
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package docker_test
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestJavaBaseImageContract(t *testing.T) {
+	contract := docker.NewBaseImageContract(config.JavaLeveransepakke)
+	imageConfig := &docker.ImageConfig{
+		Env: []string{"HOME=/u01", "TRUST_STORE=/etc/pki/java/cacerts"},
+		Labels: map[string]string{
+			docker.LABEL_CONTRACT:       "1",
+			docker.LABEL_CONTRACT_PATHS: "/u01/logs, /u01/bin",
+		},
+	}
+
+	assert.NoError(t, contract.Verify("aurora/oracle8:1.7.0", imageConfig))
+}
+
+func TestBaseImageContractViolations(t *testing.T) {
+	contract := docker.NewBaseImageContract(config.JavaLeveransepakke)
+	imageConfig := &docker.ImageConfig{
+		Env: []string{"HOME=/u01"},
+		Labels: map[string]string{
+			docker.LABEL_CONTRACT:       "2",
+			docker.LABEL_CONTRACT_PATHS: "/u01/bin",
+		},
+	}
+
+	err := contract.Verify("aurora/oracle8:1.7.0", imageConfig)
+
+	assert.EqualError(t, err, "Base image aurora/oracle8:1.7.0 does not satisfy the contract of the Architect build: "+
+		"env TRUST_STORE is not set; contract version 2 is not supported, expected one of 1; "+
+		"path /u01/logs is not declared in architect.contract.paths")
+}
+
+func TestBaseImageWithoutContractIsOnlyCheckedForEnv(t *testing.T) {
+	contract := docker.NewBaseImageContract(config.NodeJsLeveransepakke)
+
+	assert.NoError(t, contract.Verify("aurora/wrench:1.0.0", &docker.ImageConfig{Env: []string{"HOME=/u01"}}))
+	assert.EqualError(t, contract.Verify("aurora/wrench:1.0.0", &docker.ImageConfig{}),
+		"Base image aurora/wrench:1.0.0 does not satisfy the contract of the Architect build: env HOME is not set")
+}
@@ -0,0 +1,137 @@
+package docker
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	PushSecretPath          = "/var/run/secrets/openshift.io/push/.dockercfg"
+	PullSecretPath          = "/var/run/secrets/openshift.io/pull/.dockercfg"
+	ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// RegistryCredentialsFunc resolves the credentials of a registry. Returns nil for anonymous access.
+type RegistryCredentialsFunc func(registry string) (*RegistryCredentials, error)
+
+// RegistryCredentialsProvider is a source of registry credentials. Credentials returns nil if the source
+// has no credentials for the registry.
+type RegistryCredentialsProvider struct {
+	Name        string
+	Credentials func(registry string) (*RegistryCredentials, error)
+}
+
+// CusterRegistryCredentials uses the push secret, the pull secret or the service account token of the build,
+// in that order. The registry is accessed anonymously if none of them has credentials for it.
+func CusterRegistryCredentials() func(string) (*RegistryCredentials, error) {
+	return ChainRegistryCredentials(
+		DockerConfigCredentials("push secret", PushSecretPath),
+		DockerConfigCredentials("pull secret", PullSecretPath),
+		ServiceAccountTokenCredentials(ServiceAccountTokenPath),
+	)
+}
+
+// OutputTargetCredentials reads the credentials of the output targets that have a credentials file from that
+// file. Other registries get the credentials of the fallback.
+func OutputTargetCredentials(targets []config.OutputTarget, fallback func(string) (*RegistryCredentials, error)) func(string) (*RegistryCredentials, error) {
+	return func(registry string) (*RegistryCredentials, error) {
+		for _, target := range targets {
+			if target.CredentialsFile != "" && NormalizeRegistry(target.Registry) == NormalizeRegistry(registry) {
+				return ChainRegistryCredentials(
+					DockerConfigCredentials("credentials file of output target "+target.Registry, target.CredentialsFile),
+				)(registry)
+			}
+		}
+		return fallback(registry)
+	}
+}
+
+// CachedRegistryCredentials resolves the credentials of each registry host once, as a build uses the same
+// registries for several operations, possibly at the same time
+func CachedRegistryCredentials(credentials func(string) (*RegistryCredentials, error)) RegistryCredentialsFunc {
+	var mutex sync.Mutex
+	cache := make(map[string]*RegistryCredentials)
+	return func(registry string) (*RegistryCredentials, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		host := NormalizeRegistry(registry)
+		if cached, ok := cache[host]; ok {
+			return cached, nil
+		}
+		resolved, err := credentials(registry)
+		if err != nil {
+			return nil, err
+		}
+		cache[host] = resolved
+		return resolved, nil
+	}
+}
+
+// ChainRegistryCredentials returns the credentials of the first provider that has credentials for the registry,
+// or nil for anonymous access. An error from a provider stops the chain.
+func ChainRegistryCredentials(providers ...RegistryCredentialsProvider) func(string) (*RegistryCredentials, error) {
+	return func(registry string) (*RegistryCredentials, error) {
+		for _, provider := range providers {
+			credentials, err := provider.Credentials(registry)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to read registry credentials from %s", provider.Name)
+			}
+			if credentials != nil {
+				logrus.Infof("Using registry credentials for %s from %s", registry, provider.Name)
+				return credentials, nil
+			}
+			logrus.Debugf("No registry credentials for %s in %s", registry, provider.Name)
+		}
+		logrus.Infof("No registry credentials for %s. Using anonymous access", registry)
+		return nil, nil
+	}
+}
+
+// DockerConfigCredentials reads the credentials from a Docker config, e.g. a secret mounted in the build
+func DockerConfigCredentials(name string, dockerConfigPath string) RegistryCredentialsProvider {
+	return RegistryCredentialsProvider{
+		Name: name,
+		Credentials: func(registry string) (*RegistryCredentials, error) {
+			return findRegistryCredentials(registry, dockerConfigPath)
+		},
+	}
+}
+
+// ServiceAccountTokenCredentials uses the token of the service account of the pod for the internal registry
+// of the cluster. The registry accepts the token as password for any user name.
+func ServiceAccountTokenCredentials(tokenPath string) RegistryCredentialsProvider {
+	return RegistryCredentialsProvider{
+		Name: "service account token",
+		Credentials: func(registry string) (*RegistryCredentials, error) {
+			if !IsInternalRegistry(registry) {
+				return nil, nil
+			}
+			token, err := ioutil.ReadFile(tokenPath)
+			if os.IsNotExist(err) {
+				return nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+			return &RegistryCredentials{
+				Username:      "serviceaccount",
+				Password:      strings.TrimSpace(string(token)),
+				Serveraddress: registry,
+			}, nil
+		},
+	}
+}
+
+// IsInternalRegistry tells if the registry is a service in the cluster, e.g. docker-registry.default.svc:5000
+func IsInternalRegistry(registry string) bool {
+	host := NormalizeRegistry(registry)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.HasSuffix(host, ".svc") || strings.HasSuffix(host, ".svc.cluster.local")
+}
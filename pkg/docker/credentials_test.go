@@ -0,0 +1,106 @@
+package docker_test
+
+import (
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChainRegistryCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pushSecret := filepath.Join(dir, "push.dockercfg")
+	tokenFile := filepath.Join(dir, "token")
+	// auth is "foo:barpw" base64 encoded
+	assert.NoError(t, ioutil.WriteFile(pushSecret, []byte(`{"registry.aurora.no:5000": {"auth": "Zm9vOmJhcnB3Cg=="}}`), 0600))
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("sa-token\n"), 0600))
+
+	credentials := docker.ChainRegistryCredentials(
+		docker.DockerConfigCredentials("push secret", pushSecret),
+		docker.DockerConfigCredentials("pull secret", filepath.Join(dir, "missing.dockercfg")),
+		docker.ServiceAccountTokenCredentials(tokenFile),
+	)
+
+	cred, err := credentials("registry.aurora.no:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.RegistryCredentials{Username: "foo", Password: "barpw", Serveraddress: "registry.aurora.no:5000"}, cred)
+
+	cred, err = credentials("docker-registry.default.svc:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, &docker.RegistryCredentials{Username: "serviceaccount", Password: "sa-token", Serveraddress: "docker-registry.default.svc:5000"}, cred)
+
+	cred, err = credentials("docker.io")
+	assert.NoError(t, err)
+	assert.Nil(t, cred)
+}
+
+func TestChainRegistryCredentialsStopsOnError(t *testing.T) {
+	failing := docker.RegistryCredentialsProvider{
+		Name: "broken secret",
+		Credentials: func(registry string) (*docker.RegistryCredentials, error) {
+			return nil, errors.New("Failed to unmarshal Docker config json")
+		},
+	}
+	_, err := docker.ChainRegistryCredentials(failing, docker.ServiceAccountTokenCredentials("token"))("registry.svc:5000")
+	assert.EqualError(t, err, "Failed to read registry credentials from broken secret: Failed to unmarshal Docker config json")
+}
+
+func TestCachedRegistryCredentials(t *testing.T) {
+	calls := make(map[string]int)
+	credentials := docker.CachedRegistryCredentials(func(registry string) (*docker.RegistryCredentials, error) {
+		calls[registry]++
+		if registry == "docker.io" {
+			return nil, nil
+		}
+		return &docker.RegistryCredentials{Username: "user-" + registry, Password: "pw"}, nil
+	})
+
+	base, err := credentials("docker.io")
+	assert.NoError(t, err)
+	assert.Nil(t, base)
+	output, err := credentials("registry.aurora.no:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-registry.aurora.no:5000", output.Username)
+
+	_, err = credentials("https://registry-1.docker.io/v2/")
+	assert.NoError(t, err)
+	_, err = credentials("registry.aurora.no:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"docker.io": 1, "registry.aurora.no:5000": 1}, calls)
+}
+
+func TestOutputTargetCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	drSecret := filepath.Join(dir, "dr.dockercfg")
+	// auth is "foo:barpw" base64 encoded
+	assert.NoError(t, ioutil.WriteFile(drSecret, []byte(`{"dr-registry.aurora.no:5000": {"auth": "Zm9vOmJhcnB3Cg=="}}`), 0600))
+
+	credentials := docker.OutputTargetCredentials([]config.OutputTarget{
+		{Registry: "https://dr-registry.aurora.no:5000", CredentialsFile: drSecret},
+		{Registry: "registry.partner.no"},
+	}, func(registry string) (*docker.RegistryCredentials, error) {
+		return &docker.RegistryCredentials{Username: "fallback", Serveraddress: registry}, nil
+	})
+
+	cred, err := credentials("dr-registry.aurora.no:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", cred.Username)
+
+	cred, err = credentials("registry.partner.no")
+	assert.NoError(t, err)
+	assert.Equal(t, "fallback", cred.Username)
+}
+
+func TestIsInternalRegistry(t *testing.T) {
+	assert.True(t, docker.IsInternalRegistry("docker-registry.default.svc:5000"))
+	assert.True(t, docker.IsInternalRegistry("https://image-registry.openshift-image-registry.svc.cluster.local:5000"))
+	assert.False(t, docker.IsInternalRegistry("docker-registry.aurora.sits.no:5000"))
+}
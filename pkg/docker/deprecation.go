@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	extVersion "github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"strings"
+	"time"
+)
+
+// Base images are deprecated with a message, or true, in the deprecated label. The end of life date is on the
+// form 2006-01-02.
+const (
+	LABEL_DEPRECATED = "architect.deprecated"
+	LABEL_EOL_DATE   = "architect.eol-date"
+)
+
+const eolDateLayout = "2006-01-02"
+
+// CheckBaseImagePolicy checks the base image against the base image policy and its own deprecation labels.
+// Returns why the base image is deprecated, if it is and the policy allows it. A nil policy allows all base
+// images, and deprecated base images are only warned about.
+func CheckBaseImagePolicy(policy *config.BaseImagePolicy, baseImage runtime.DockerImage, imageConfig *ImageConfig,
+	now time.Time) (string, error) {
+	if policy == nil {
+		policy = &config.BaseImagePolicy{}
+	}
+	name := baseImage.Repository + ":" + baseImage.Tag
+	deprecations := make([]string, 0)
+
+	if len(policy.BaseImages) > 0 {
+		allowed := policy.Find(baseImage.Repository)
+		if allowed == nil {
+			return "", errors.Errorf("Base image %s is not allowed by the base image policy", baseImage.Repository)
+		}
+		if allowed.MinVersion != "" {
+			version, err := extVersion.NewVersion(baseImage.Tag)
+			if err != nil {
+				return "", errors.Wrapf(err, "Version of base image %s can not be compared with the policy", name)
+			}
+			minVersion, err := extVersion.NewVersion(allowed.MinVersion)
+			if err != nil {
+				return "", errors.Wrapf(err, "Invalid minVersion for %s in the base image policy", allowed.Name)
+			}
+			if version.Compare(minVersion) < 0 {
+				return "", errors.Errorf("Base image %s is older than %s, the lowest version allowed by the base image policy",
+					name, allowed.MinVersion)
+			}
+		}
+		if allowed.Deprecated != "" {
+			deprecations = append(deprecations, allowed.Deprecated)
+		}
+	}
+
+	if deprecated := strings.TrimSpace(imageConfig.Labels[LABEL_DEPRECATED]); deprecated != "" && deprecated != "false" {
+		if deprecated == "true" {
+			deprecated = "marked as deprecated"
+		}
+		deprecations = append(deprecations, deprecated)
+	}
+
+	if eol := strings.TrimSpace(imageConfig.Labels[LABEL_EOL_DATE]); eol != "" {
+		eolDate, err := time.Parse(eolDateLayout, eol)
+		if err != nil {
+			logrus.Warnf("Base image %s has an invalid %s label %s. Expected a date like %s", name, LABEL_EOL_DATE,
+				eol, eolDateLayout)
+		} else if !now.Before(eolDate) {
+			if policy.FailAfterEol {
+				return "", errors.Errorf("Base image %s reached its end of life on %s", name, eol)
+			}
+			deprecations = append(deprecations, fmt.Sprintf("end of life since %s", eol))
+		} else {
+			logrus.Infof("Base image %s reaches its end of life on %s", name, eol)
+		}
+	}
+
+	if len(deprecations) == 0 {
+		return "", nil
+	}
+	message := strings.Join(deprecations, "; ")
+	if policy.FailOnDeprecated {
+		return "", errors.Errorf("Base image %s is deprecated: %s", name, message)
+	}
+	logrus.Warnf("Base image %s is deprecated: %s", name, message)
+	return message, nil
+}
@@ -0,0 +1,66 @@
+package docker_test
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+var oracle8 = runtime.DockerImage{Repository: "aurora/oracle8", Tag: "1.7.0"}
+
+func TestBaseImageWithoutDeprecation(t *testing.T) {
+	imageConfig := &docker.ImageConfig{Labels: map[string]string{docker.LABEL_EOL_DATE: "2027-01-01"}}
+
+	deprecated, err := docker.CheckBaseImagePolicy(nil, oracle8, imageConfig, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "", deprecated)
+}
+
+func TestDeprecatedBaseImageIsWarnedAbout(t *testing.T) {
+	imageConfig := &docker.ImageConfig{Labels: map[string]string{
+		docker.LABEL_DEPRECATED: "Use aurora/wingnut11",
+		docker.LABEL_EOL_DATE:   "2026-01-01",
+	}}
+
+	deprecated, err := docker.CheckBaseImagePolicy(nil, oracle8, imageConfig, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Use aurora/wingnut11; end of life since 2026-01-01", deprecated)
+}
+
+func TestBaseImagePolicyFailures(t *testing.T) {
+	eol := &docker.ImageConfig{Labels: map[string]string{docker.LABEL_EOL_DATE: "2026-03-01"}}
+	deprecated := &docker.ImageConfig{Labels: map[string]string{docker.LABEL_DEPRECATED: "true"}}
+	none := &docker.ImageConfig{}
+
+	_, err := docker.CheckBaseImagePolicy(&config.BaseImagePolicy{FailAfterEol: true}, oracle8, eol, now)
+	assert.EqualError(t, err, "Base image aurora/oracle8:1.7.0 reached its end of life on 2026-03-01")
+
+	_, err = docker.CheckBaseImagePolicy(&config.BaseImagePolicy{FailOnDeprecated: true}, oracle8, deprecated, now)
+	assert.EqualError(t, err, "Base image aurora/oracle8:1.7.0 is deprecated: marked as deprecated")
+
+	policy := &config.BaseImagePolicy{BaseImages: []config.AllowedBaseImage{{Name: "aurora/wingnut11"}}}
+	_, err = docker.CheckBaseImagePolicy(policy, oracle8, none, now)
+	assert.EqualError(t, err, "Base image aurora/oracle8 is not allowed by the base image policy")
+
+	policy = &config.BaseImagePolicy{BaseImages: []config.AllowedBaseImage{{Name: "aurora/oracle8", MinVersion: "1.8"}}}
+	_, err = docker.CheckBaseImagePolicy(policy, oracle8, none, now)
+	assert.EqualError(t, err, "Base image aurora/oracle8:1.7.0 is older than 1.8, the lowest version allowed by the base image policy")
+}
+
+func TestBaseImageDeprecatedByPolicy(t *testing.T) {
+	policy := &config.BaseImagePolicy{BaseImages: []config.AllowedBaseImage{
+		{Name: "aurora/oracle8", MinVersion: "1.7.0", Deprecated: "Use aurora/wingnut11"},
+	}}
+
+	deprecated, err := docker.CheckBaseImagePolicy(policy, oracle8, &docker.ImageConfig{}, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Use aurora/wingnut11", deprecated)
+}
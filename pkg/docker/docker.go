@@ -2,27 +2,31 @@ package docker
 
 import (
 	"archive/tar"
-	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/pkg/errors"
 	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/util"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 )
 
-//TODO: Fix context!!!
 type RegistryCredentials struct {
 	Username      string `json:"username,omitempty"`
 	Password      string `json:"password,omitempty"`
 	Serveraddress string `json:"serveraddress,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
 }
 
 type DockerBuildConfig struct {
@@ -30,131 +34,198 @@ type DockerBuildConfig struct {
 	DockerRepository string ///TODO: Refactor? We need to have to different for nodejs
 	BuildFolder      string
 	Baseimage        runtime.DockerImage //We need to pull the newest image...
+	//The platform of the image in a multi-platform build. Nil for a single-platform build
+	Platform *Platform
 }
 
 type DockerClient struct {
-	Client DockerClientAPI
+	// Size of the layers pushed by this client. First in the struct, so that it is aligned for atomic access
+	pushedBytes int64
+	Client      DockerClientAPI
+	// Pulls and pushes are retried on transient registry errors
+	Retry util.RetryPolicy
+	// Max number of tags pushed at the same time. Zero uses the default
+	Concurrency int
 }
 
-func NewDockerClient() (*DockerClient, error) {
+func NewDockerClient(retry util.RetryPolicy, concurrency int) (*DockerClient, error) {
 	cli, err := client.NewClient(client.DefaultDockerHost, "1.23", nil, nil)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &DockerClient{Client: DockerClientProxy{*cli}}, nil
+	return &DockerClient{Client: DockerClientProxy{*cli}, Retry: retry, Concurrency: concurrency}, nil
 }
 
-//THIS IS BUGGY!
-func (d *DockerClient) PullImage(baseimage runtime.DockerImage) error {
-	logrus.Infof("Pulling %s", baseimage.GetCompleteDockerTagName())
-	output, err := d.Client.ImagePull(context.Background(), baseimage.GetCompleteDockerTagName(), types.ImagePullOptions{})
-
-	// ImageBuild will not return error message if build fails.
-	var bodyLine string = ""
-	scanner := bufio.NewScanner(output)
-	for scanner.Scan() {
-		bodyLine = scanner.Text()
-		logrus.Debug(bodyLine)
+// PullImage pulls the image from the registry, with the credentials of the registry if not nil. Fails with
+// UnauthorizedError or ImageNotFoundError if the registry refuses the pull.
+func (d *DockerClient) PullImage(ctx context.Context, baseimage runtime.DockerImage, credentials *RegistryCredentials) error {
+	image := baseimage.GetCompleteDockerTagName()
+	logrus.Infof("Pulling %s", image)
+	encodedCredentials, err := encodeCredentials(credentials)
+	if err != nil {
+		return err
 	}
-	return err
+	pullOptions := types.ImagePullOptions{RegistryAuth: encodedCredentials}
+	return d.Retry.Do(ctx, "Pull of "+image, func() error {
+		output, err := d.Client.ImagePull(ctx, image, pullOptions)
+		if err != nil {
+			return registryError(image, err)
+		}
+		defer output.Close()
+
+		err = readJSONMessages(output, logProgress)
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "Pull interrupted")
+		}
+		return registryError(image, err)
+	})
 }
 
-func (d *DockerClient) BuildImage(buildFolder string) (string, error) {
+// BuildImage builds the image and returns its id. Fails with BuildStepError if a step in the Dockerfile fails.
+func (d *DockerClient) BuildImage(ctx context.Context, buildFolder string) (string, error) {
 	dockerOpt := types.ImageBuildOptions{
 		SuppressOutput: false,
 	}
 	tarReader := createContextTarStreamReader(buildFolder)
-	build, err := d.Client.ImageBuild(context.Background(), tarReader, dockerOpt)
+	build, err := d.Client.ImageBuild(ctx, tarReader, dockerOpt)
 	if err != nil {
 		return "", errors.Wrap(err, "Error building image")
 	}
-
-	// ImageBuild will not return error message if build fails.
-	var bodyLine string = ""
-	scanner := bufio.NewScanner(build.Body)
-	for scanner.Scan() {
-		bodyLine = scanner.Text()
-		logrus.Debug(bodyLine)
-		if strings.Contains(bodyLine, "errorDetail") {
-			msg, err := JsonMapToString(bodyLine, "error")
-			if err != nil {
-				return "", errors.Wrap(err, "Error mapping JSON error message. Error in build.")
-			}
-			return "", errors.New(msg)
+	defer build.Body.Close()
+
+	// ImageBuild will not return error if build fails. The error is in the stream.
+	var step, imageid string
+	err = readJSONMessages(build.Body, func(message *jsonmessage.JSONMessage) {
+		logBuildOutput(message)
+		line := strings.TrimSpace(message.Stream)
+		if strings.HasPrefix(line, "Step ") {
+			step = line
+		} else if strings.HasPrefix(line, "Successfully built ") {
+			imageid = strings.TrimSpace(strings.TrimPrefix(line, "Successfully built "))
 		}
+	})
+	if ctx.Err() != nil {
+		return "", errors.Wrap(ctx.Err(), "Build interrupted")
 	}
-	// Get image id.
-	msg, err := JsonMapToString(bodyLine, "stream")
+	if jsonError, ok := err.(*jsonmessage.JSONError); ok {
+		return "", &BuildStepError{Step: step, Message: jsonError.Message}
+	} else if err != nil {
+		return "", err
+	}
+	if imageid == "" {
+		return "", errors.New("Docker did not report the id of the built image")
+	}
+	return imageid, nil
+}
 
-	return strings.TrimSpace(strings.TrimPrefix(msg, "Successfully built ")), nil
+// CheckPlatform runs a command in the base image of a platform. Builds for a platform other than that of the
+// daemon run the RUN instructions of the Dockerfile with emulation, and fail if the daemon has no emulator
+// for the platform. The base image must be pulled.
+func (d *DockerClient) CheckPlatform(ctx context.Context, baseImage runtime.DockerImage, platform Platform) error {
+	dir, err := ioutil.TempDir("", "platform")
+	if err != nil {
+		return errors.Wrap(err, "Failed to create Docker context")
+	}
+	defer os.RemoveAll(dir)
+	dockerfile := "FROM " + baseImage.GetCompleteDockerTagName() + "\nRUN true\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		return errors.Wrap(err, "Failed to create Dockerfile")
+	}
+	logrus.Infof("Check that the Docker daemon can run %s images", platform)
+	_, err = d.BuildImage(ctx, dir)
+	if IsBuildStepError(err) {
+		return errors.Wrapf(err, "The Docker daemon can not run %s images. Builds for other platforms than the "+
+			"platform of the build node need emulation, e.g. qemu registered with binfmt_misc", platform)
+	}
+	return err
 }
 
-func (d *DockerClient) TagImage(imageId string, tag string) error {
-	if err := d.Client.ImageTag(context.Background(), imageId, tag); err != nil {
+func (d *DockerClient) TagImage(ctx context.Context, imageId string, tag string) error {
+	if err := d.Client.ImageTag(ctx, imageId, tag); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (d *DockerClient) PushImage(tag string, credentials *RegistryCredentials) error {
+func (d *DockerClient) PushImage(ctx context.Context, tag string, credentials *RegistryCredentials) error {
 	logrus.Infof("Pushing image %s", tag)
 
-	var encodedCredentials string
-	if credentials == nil {
-		encodedCredentials = ""
-	} else {
-		c, err := credentials.Encode()
-		if err != nil {
-			return errors.Wrap(err, "Unable to create credentials")
-		}
-		encodedCredentials = c
+	encodedCredentials, err := encodeCredentials(credentials)
+	if err != nil {
+		return err
 	}
 	pushOptions := createImagePushOptions(encodedCredentials)
 
-	push, err := d.Client.ImagePush(context.Background(), tag, pushOptions)
+	// Layers that are already pushed are skipped, so a failed push can be retried
+	return d.Retry.Do(ctx, "Push of "+tag, func() error {
+		return d.pushImage(ctx, tag, pushOptions)
+	})
+}
+
+func (d *DockerClient) pushImage(ctx context.Context, tag string, pushOptions types.ImagePushOptions) error {
+	push, err := d.Client.ImagePush(ctx, tag, pushOptions)
 
 	if err != nil {
-		return err
+		return registryError(tag, err)
 	}
 
 	defer push.Close()
 
-	// ImageBuild will not return error message if build fails.
-	scanner := bufio.NewScanner(push)
-	for scanner.Scan() {
-		bodyLine := scanner.Text()
-		logrus.Debug(bodyLine)
-		if strings.Contains(bodyLine, "errorDetail") {
-			msg, err := JsonMapToString(bodyLine, "error")
-			if err != nil {
-				return errors.Wrap(err, "Error mapping JSON error message. Unknown error")
-			}
-			return errors.New(msg)
+	// Layers that already exist in the registry are not pushed, and have no progress
+	layers := make(map[string]int64)
+	err = readJSONMessages(push, func(message *jsonmessage.JSONMessage) {
+		logProgress(message)
+		if message.Status == "Pushing" && message.Progress != nil && message.Progress.Total > layers[message.ID] {
+			layers[message.ID] = message.Progress.Total
 		}
+	})
+	if ctx.Err() != nil {
+		return errors.Wrap(ctx.Err(), "Push interrupted")
+	}
+	if err != nil {
+		return registryError(tag, err)
+	}
+	for _, size := range layers {
+		atomic.AddInt64(&d.pushedBytes, size)
 	}
-
 	return nil
 }
 
-func (d *DockerClient) PushImages(tags []string, credentials *RegistryCredentials) error {
-	for _, tag := range tags {
-		err := d.PushImage(tag, credentials)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to push %s", tag)
-		}
+// PushedBytes is the size of the layers pushed by the client
+func (d *DockerClient) PushedBytes() int64 {
+	return atomic.LoadInt64(&d.pushedBytes)
+}
+
+// PushImages pushes the first tag alone, so that the layers are uploaded once. The layers then exist in the
+// registry, and the other tags are pushed concurrently.
+func (d *DockerClient) PushImages(ctx context.Context, tags []string, credentials *RegistryCredentials) error {
+	if len(tags) == 0 {
+		return nil
 	}
-	return nil
+	if err := d.PushImage(ctx, tags[0], credentials); err != nil {
+		return errors.Wrapf(err, "Failed to push %s", tags[0])
+	}
+	rest := tags[1:]
+	return util.RunConcurrently(ctx, len(rest), d.Concurrency, func(ctx context.Context, i int) error {
+		if err := d.PushImage(ctx, rest[i], credentials); err != nil {
+			return errors.Wrapf(err, "Failed to push %s", rest[i])
+		}
+		return nil
+	})
 }
 
-func JsonMapToString(jsonStr string, key string) (string, error) {
-	var f interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &f); err != nil {
-		return "", err
+// encodeCredentials encodes the credentials for the Docker daemon. No credentials is an empty string.
+func encodeCredentials(credentials *RegistryCredentials) (string, error) {
+	if credentials == nil {
+		return "", nil
+	}
+	encoded, err := credentials.Encode()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to create credentials")
 	}
-	errorMap := f.(map[string]interface{})
-	return errorMap[key].(string), nil
+	return encoded, nil
 }
 
 func (rc RegistryCredentials) Encode() (string, error) {
@@ -167,35 +238,47 @@ func (rc RegistryCredentials) Encode() (string, error) {
 	return base64.StdEncoding.EncodeToString(ser), nil
 }
 
+// GetDockerConfigPath returns the Docker config of the user, as found by the Docker CLI: config.json in
+// DOCKER_CONFIG or ~/.docker, or the legacy ~/.dockercfg. Returns the first of them if none exist.
 func GetDockerConfigPath() (string, error) {
+	if dockerConfig := os.Getenv("DOCKER_CONFIG"); dockerConfig != "" {
+		return filepath.Join(dockerConfig, "config.json"), nil
+	}
+
 	usr, err := user.Current()
 
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(usr.HomeDir, ".dockercfg"), nil
+	paths := []string{
+		filepath.Join(usr.HomeDir, ".docker", "config.json"),
+		filepath.Join(usr.HomeDir, ".dockercfg"),
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return paths[0], nil
 }
 
+// LocalRegistryCredentials reads the credentials from the Docker config of the user. Registries without
+// credentials in the config are accessed anonymously.
 func LocalRegistryCredentials() func(string) (*RegistryCredentials, error) {
-	return func(outputRegistry string) (*RegistryCredentials, error) {
+	return func(registry string) (*RegistryCredentials, error) {
 		dockerConfigPath, err := GetDockerConfigPath()
 
 		if err != nil {
 			return nil, err
 		}
 
-		return readRegistryCredentials(outputRegistry, dockerConfigPath)
-	}
-}
-
-func CusterRegistryCredentials() func(string) (*RegistryCredentials, error) {
-	return func(outputRegistry string) (*RegistryCredentials, error) {
-		return readRegistryCredentials(outputRegistry, "/var/run/secrets/openshift.io/push/.dockercfg")
+		return ChainRegistryCredentials(DockerConfigCredentials(dockerConfigPath, dockerConfigPath))(registry)
 	}
 }
 
-func readRegistryCredentials(outputRegistry string, dockerConfigPath string) (*RegistryCredentials, error) {
+// findRegistryCredentials returns nil if the Docker config does not exist or has no entry for the registry
+func findRegistryCredentials(outputRegistry string, dockerConfigPath string) (*RegistryCredentials, error) {
 	_, err := os.Stat(dockerConfigPath)
 
 	if err != nil {
@@ -212,11 +295,12 @@ func readRegistryCredentials(outputRegistry string, dockerConfigPath string) (*R
 	if err != nil {
 		return nil, err
 	}
+	defer dockerConfigReader.Close()
 
 	dockerConfig, err := ReadConfig(dockerConfigReader)
 
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "Failed to read %s", dockerConfigPath)
 	}
 
 	basicCredentials, err := dockerConfig.GetCredentials(outputRegistry)
@@ -225,20 +309,16 @@ func readRegistryCredentials(outputRegistry string, dockerConfigPath string) (*R
 		return nil, err
 	} else if basicCredentials == nil {
 		logrus.Infof("Will not load registry credentials. No entry for %s in %s.", outputRegistry, dockerConfigPath)
-		return nil, errors.Errorf("No credentials found for registry " + outputRegistry)
-	}
-
-	registryCredentials := RegistryCredentials{
-		basicCredentials.User,
-		basicCredentials.Password,
-		outputRegistry,
-	}
-
-	if err != nil {
-		return nil, err
+		return nil, nil
 	}
 
-	return &registryCredentials, nil
+	return &RegistryCredentials{
+		Username:      basicCredentials.User,
+		Password:      basicCredentials.Password,
+		Serveraddress: outputRegistry,
+		IdentityToken: basicCredentials.IdentityToken,
+		RegistryToken: basicCredentials.RegistryToken,
+	}, nil
 }
 
 func createImagePushOptions(credentials string) types.ImagePushOptions {
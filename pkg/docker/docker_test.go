@@ -5,11 +5,14 @@ import (
 	"context"
 	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
 	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/util"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -32,7 +35,7 @@ func TestBuildImageSuccess(t *testing.T) {
 		t.Error(err)
 	}
 
-	if imageid, err := target.BuildImage(dir); err != nil {
+	if imageid, err := target.BuildImage(context.Background(), dir); err != nil {
 		t.Error(err)
 	} else if imageid != "6757955c1ca1" {
 		t.Errorf("Build returned unexpected image id %s", imageid)
@@ -47,7 +50,7 @@ func TestBuildImageIllegalDockerfile(t *testing.T) {
 		t.Error(err)
 	}
 
-	if _, err = target.BuildImage(dir); err == nil {
+	if _, err = target.BuildImage(context.Background(), dir); err == nil {
 		t.Error("Expected error")
 	} else if !strings.Contains(err.Error(), "Unknown instruction: FOO") {
 		t.Error("Expected error to contain cause of error")
@@ -63,11 +66,112 @@ func TestBuildImageError(t *testing.T) {
 		t.Error(err)
 	}
 
-	if _, err = target.BuildImage(dir); err == nil {
+	if _, err = target.BuildImage(context.Background(), dir); err == nil {
 		t.Error("Expected error")
 	}
 }
 
+func TestBuildImageStepFailed(t *testing.T) {
+	target := getBuildTargetFromFile(t, "testdata/rsp_build_step_failed.txt")
+
+	dir, err := createDockerBase()
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = target.BuildImage(context.Background(), dir)
+	if !docker.IsBuildStepError(err) {
+		t.Fatalf("Expected build step error, was %v", err)
+	}
+	stepError := err.(*docker.BuildStepError)
+	if stepError.Step != "Step 2 : RUN exit 3" {
+		t.Errorf("Expected failing step to be reported, was %s", stepError.Step)
+	}
+	if !strings.Contains(err.Error(), "returned a non-zero code: 3") {
+		t.Errorf("Expected error to contain cause of error, was %s", err)
+	}
+}
+
+func TestCheckPlatformWithoutEmulation(t *testing.T) {
+	target := getBuildTargetFromFile(t, "testdata/rsp_build_exec_format_error.txt")
+	baseImage := runtime.DockerImage{
+		Registry:   "docker-registry.themoon.com:5000",
+		Repository: "aurora/oracle8",
+		Digest:     "sha256:2b3a5d5d2c1f1b1e0f6a2c0d8e4f3a1b9c7d5e3f1a2b4c6d8e0f1a3b5c7d9e1f",
+	}
+
+	err := target.CheckPlatform(context.Background(), baseImage, docker.Platform{OS: "linux", Architecture: "arm64"})
+
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	if !strings.Contains(err.Error(), "can not run linux/arm64 images") {
+		t.Errorf("Expected error to tell that the platform can not run, was %s", err)
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	target := getBuildTargetFromFile(t, "testdata/rsp_build_success.txt")
+
+	err := target.CheckPlatform(context.Background(), runtime.DockerImage{Repository: "aurora/oracle8", Tag: "1"},
+		docker.Platform{OS: "linux", Architecture: "amd64"})
+
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuildImageWithoutImageId(t *testing.T) {
+	target := docker.DockerClient{Client: DockerClientMock{ImageBuildFunc: func(ctx context.Context, context io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+		return types.ImageBuildResponse{
+			Body: ioutil.NopCloser(strings.NewReader(`{"stream":"Step 1 : FROM alpine:3.3\n"}`)),
+		}, nil
+	}}}
+
+	dir, err := createDockerBase()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = target.BuildImage(context.Background(), dir); err == nil {
+		t.Error("Expected error when the stream ends without an image id")
+	}
+}
+
+func TestPullImageSuccess(t *testing.T) {
+	target := getPullTargetFromFile(t, "testdata/rsp_pull_success.txt")
+
+	err := target.PullImage(context.Background(), runtime.DockerImage{Registry: "registry09:5000", Repository: "aurora/oracle8", Tag: "1"}, nil)
+
+	if err != nil {
+		t.Errorf("Returned unexpected error %s", err)
+	}
+}
+
+func TestPullImageNotFound(t *testing.T) {
+	target := getPullTargetFromFile(t, "testdata/rsp_pull_not_found.txt")
+
+	err := target.PullImage(context.Background(), runtime.DockerImage{Registry: "registry09:5000", Repository: "aurora/oracle8", Tag: "99"}, nil)
+
+	if !docker.IsImageNotFound(err) {
+		t.Errorf("Expected image not found error, was %v", err)
+	}
+}
+
+func TestPullImageError(t *testing.T) {
+	target := docker.DockerClient{Client: DockerClientMock{ImagePullFunc: func(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+		return nil, errors.New("Nasty errror occurred")
+	}}}
+
+	err := target.PullImage(context.Background(), runtime.DockerImage{Registry: "registry09:5000", Repository: "aurora/oracle8", Tag: "1"}, nil)
+
+	if err == nil {
+		t.Error("Expected error")
+	} else if !strings.Contains(err.Error(), "Nasty errror occurred") {
+		t.Errorf("Expected error to contain cause of error, was %s", err)
+	}
+}
+
 func TestPushImageSuccess(t *testing.T) {
 	target := getPushTargetFromFile(t, "testdata/rsp_push_success.txt")
 
@@ -75,7 +179,7 @@ func TestPushImageSuccess(t *testing.T) {
 	//target, _ := docker.NewDockerClient(&docker.DockerClientConfig{Endpoint: ""})
 
 	credentials := docker.RegistryCredentials{}
-	err := target.PushImage("foo/bar", &credentials)
+	err := target.PushImage(context.Background(), "foo/bar", &credentials)
 	//err := target.PushImage("docker-registry-default.qa.paas.skead.no/aurora/architecttest:1.0.2")
 
 	if err != nil {
@@ -83,16 +187,31 @@ func TestPushImageSuccess(t *testing.T) {
 	}
 }
 
+func TestPushImageCountsPushedLayers(t *testing.T) {
+	target := getPushTargetFromFile(t, "testdata/rsp_push_layers.txt")
+
+	err := target.PushImage(context.Background(), "foo/bar", &docker.RegistryCredentials{})
+
+	if err != nil {
+		t.Errorf("Returned unexpected error %s", err)
+	}
+	if target.PushedBytes() != 2048 {
+		t.Errorf("Expected 2048 pushed bytes, was %d", target.PushedBytes())
+	}
+}
+
 func TestPushImageUnauthorized(t *testing.T) {
 	target := getPushTargetFromFile(t, "testdata/rsp_push_unauthorized.txt")
 
 	credentials := docker.RegistryCredentials{}
-	err := target.PushImage("foo/baz", &credentials)
+	err := target.PushImage(context.Background(), "foo/baz", &credentials)
 
 	if err == nil {
 		t.Error("Expected error")
 	} else if !strings.Contains(err.Error(), "unauthorized: authentication required") {
 		t.Errorf("Expected error to contain cause of error, was %s", err)
+	} else if !docker.IsUnauthorized(err) {
+		t.Errorf("Expected unauthorized error, was %T", err)
 	}
 }
 
@@ -100,7 +219,7 @@ func TestPushImageError(t *testing.T) {
 	target := getPushTargetError(t)
 
 	credentials := docker.RegistryCredentials{}
-	err := target.PushImage("foo/qux", &credentials)
+	err := target.PushImage(context.Background(), "foo/qux", &credentials)
 
 	if err == nil {
 		t.Error("Expected error")
@@ -109,6 +228,88 @@ func TestPushImageError(t *testing.T) {
 	}
 }
 
+func TestPushImageRetriesDroppedConnection(t *testing.T) {
+	body, err := ioutil.ReadFile("testdata/rsp_push_success.txt")
+	if err != nil {
+		t.Fatal(err, "Failed to read testdata file")
+	}
+	pushes := 0
+	target := docker.DockerClient{
+		Client: DockerClientMock{ImagePushFunc: func(ctx context.Context, ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
+			pushes++
+			if pushes == 1 {
+				return ioutil.NopCloser(strings.NewReader(`{"errorDetail":{"message":"Put https://registry/v2/foo/bar/blobs/uploads/1: read tcp: connection reset by peer"},"error":"Put https://registry/v2/foo/bar/blobs/uploads/1: read tcp: connection reset by peer"}`)), nil
+			}
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}},
+		Retry: util.RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond},
+	}
+
+	err = target.PushImage(context.Background(), "foo/bar", &docker.RegistryCredentials{})
+
+	if err != nil {
+		t.Errorf("Returned unexpected error %s", err)
+	}
+	if pushes != 2 {
+		t.Errorf("Expected 2 pushes, was %d", pushes)
+	}
+}
+
+func TestPushImageDoesNotRetryUnauthorized(t *testing.T) {
+	body, err := ioutil.ReadFile("testdata/rsp_push_unauthorized.txt")
+	if err != nil {
+		t.Fatal(err, "Failed to read testdata file")
+	}
+	pushes := 0
+	target := docker.DockerClient{
+		Client: DockerClientMock{ImagePushFunc: func(ctx context.Context, ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
+			pushes++
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}},
+		Retry: util.RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond},
+	}
+
+	err = target.PushImage(context.Background(), "foo/baz", &docker.RegistryCredentials{})
+
+	if err == nil {
+		t.Error("Expected error")
+	}
+	if pushes != 1 {
+		t.Errorf("Expected 1 push, was %d", pushes)
+	}
+}
+
+func TestPushImagesPushesFirstTagAlone(t *testing.T) {
+	body, err := ioutil.ReadFile("testdata/rsp_push_success.txt")
+	if err != nil {
+		t.Fatal(err, "Failed to read testdata file")
+	}
+	var mutex sync.Mutex
+	pushed := make([]string, 0)
+	target := docker.DockerClient{
+		Client: DockerClientMock{ImagePushFunc: func(ctx context.Context, ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			pushed = append(pushed, ref)
+			if ref == "foo/bar:1.2" || ref == "foo/bar:latest" {
+				return nil, errors.Errorf("Push of %s failed", ref)
+			}
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}},
+		Concurrency: 2,
+	}
+
+	err = target.PushImages(context.Background(), []string{"foo/bar:1.2.3", "foo/bar:1", "foo/bar:1.2", "foo/bar:latest"},
+		&docker.RegistryCredentials{})
+
+	if len(pushed) != 4 || pushed[0] != "foo/bar:1.2.3" {
+		t.Errorf("Expected foo/bar:1.2.3 to be pushed first, and all tags to be pushed, was %s", pushed)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "Failed to push foo/bar:1.2: Push of foo/bar:1.2 failed; Failed to push foo/bar:latest") {
+		t.Errorf("Expected errors in the order of the tags, was %s", err)
+	}
+}
+
 func getPushTargetFromFile(t *testing.T, file string) docker.DockerClient {
 	body, err := ioutil.ReadFile(file)
 	if err != nil {
@@ -121,6 +322,18 @@ func getPushTargetFromFile(t *testing.T, file string) docker.DockerClient {
 	}
 }
 
+func getPullTargetFromFile(t *testing.T, file string) docker.DockerClient {
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err, "Failed to read testdata file")
+	}
+
+	return docker.DockerClient{Client: DockerClientMock{ImagePullFunc: func(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}},
+	}
+}
+
 func getPushTargetError(t *testing.T) docker.DockerClient {
 	return docker.DockerClient{Client: DockerClientMock{ImagePushFunc: func(ctx context.Context, ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
 		return nil, errors.New("Nasty errror occurred")
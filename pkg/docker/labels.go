@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+)
+
+// Standard OCI image annotations, see https://github.com/opencontainers/image-spec/blob/master/annotations.md
+const (
+	LABEL_OCI_CREATED  = "org.opencontainers.image.created"
+	LABEL_OCI_VERSION  = "org.opencontainers.image.version"
+	LABEL_OCI_REVISION = "org.opencontainers.image.revision"
+	LABEL_OCI_SOURCE   = "org.opencontainers.image.source"
+	LABEL_OCI_VENDOR   = "org.opencontainers.image.vendor"
+
+	LABEL_OCI_BASE_NAME   = "org.opencontainers.image.base.name"
+	LABEL_OCI_BASE_DIGEST = "org.opencontainers.image.base.digest"
+)
+
+const (
+	LABEL_BUILD_NAME      = "io.openshift.build.name"
+	LABEL_BUILD_NAMESPACE = "io.openshift.build.namespace"
+	LABEL_BUILD_NUMBER    = "io.openshift.build.number"
+	LABEL_BUILDER_IMAGE   = "architect.builder-image"
+	LABEL_GIT_REF         = "architect.git-ref"
+	LABEL_GAV             = "architect.gav"
+	LABEL_SBOM            = "architect.sbom"
+	LABEL_BASE_DEPRECATED = "architect.base-image.deprecated"
+)
+
+const vendor = "Skatteetaten"
+
+// CreateProvenanceLabels creates the labels describing where an image comes from, including the tag and
+// digest of the base image. Labels without a value in the build are left out.
+func CreateProvenanceLabels(cfg *config.Config, auroraVersion *runtime.AuroraVersion, baseImage runtime.DockerImage,
+	imageBuildTime string) map[string]string {
+	labels := make(map[string]string)
+	addLabel := func(key string, value string) {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+	gav := cfg.ApplicationSpec.MavenGav
+	addLabel(LABEL_OCI_CREATED, imageBuildTime)
+	addLabel(LABEL_OCI_VERSION, string(auroraVersion.GetAppVersion()))
+	addLabel(LABEL_OCI_REVISION, cfg.SourceSpec.GitCommit)
+	addLabel(LABEL_OCI_SOURCE, cfg.SourceSpec.GitUri)
+	addLabel(LABEL_GIT_REF, cfg.SourceSpec.GitRef)
+	addLabel(LABEL_OCI_VENDOR, vendor)
+	addLabel(LABEL_BUILD_NAME, cfg.BuildMetadata.Name)
+	addLabel(LABEL_BUILD_NAMESPACE, cfg.BuildMetadata.Namespace)
+	addLabel(LABEL_BUILD_NUMBER, cfg.BuildMetadata.BuildNumber)
+	addLabel(LABEL_BUILDER_IMAGE, cfg.BuildMetadata.BuilderImage)
+	if gav.GroupId != "" && gav.ArtifactId != "" {
+		addLabel(LABEL_GAV, gav.GroupId+":"+gav.ArtifactId+":"+gav.Version)
+	}
+	if baseImage.Repository != "" {
+		baseName := baseImage
+		baseName.Digest = ""
+		addLabel(LABEL_OCI_BASE_NAME, baseName.GetCompleteDockerTagName())
+		addLabel(LABEL_OCI_BASE_DIGEST, baseImage.Digest)
+		addLabel(LABEL_BASE_DEPRECATED, baseImage.Deprecated)
+	}
+	return labels
+}
@@ -0,0 +1,39 @@
+package docker_test
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreateProvenanceLabels(t *testing.T) {
+	c, err := config.NewFileConfigReader("../../testdata/build-git.json").ReadConfig()
+	assert.NoError(t, err)
+	auroraVersion := runtime.NewAuroraVersion("SNAPSHOT-feature_AOS-123-42-ab543b3", true, "feature_AOS-123-SNAPSHOT",
+		runtime.CompleteVersion("SNAPSHOT-feature_AOS-123-42-ab543b3-b1.11.0-oracle8-1.2.3"))
+
+	baseImage := runtime.DockerImage{
+		Registry:   "docker-registry.themoon.com:5000",
+		Repository: "aurora/oracle8",
+		Tag:        "1.2.3",
+		Digest:     "sha256:2b3a5d5d2c1f1b1e0f6a2c0d8e4f3a1b9c7d5e3f1a2b4c6d8e0f1a3b5c7d9e1f",
+	}
+
+	labels := docker.CreateProvenanceLabels(c, auroraVersion, baseImage, "2017-09-10T14:30:10Z")
+
+	assert.Equal(t, map[string]string{
+		"org.opencontainers.image.created":     "2017-09-10T14:30:10Z",
+		"org.opencontainers.image.version":     "SNAPSHOT-feature_AOS-123-42-ab543b3",
+		"org.opencontainers.image.revision":    "ab543b32de1f2c9a2c1b0b26ba76b2a8a1f6d4c0",
+		"org.opencontainers.image.source":      "https://git.themoon.com/groupid/app.git",
+		"org.opencontainers.image.vendor":      "Skatteetaten",
+		"architect.git-ref":                    "feature/AOS-123",
+		"io.openshift.build.number":            "56",
+		"architect.builder-image":              "docker-registry.themoon.com:5000/aurora/architect@sha256:jallahash",
+		"architect.gav":                        "groupid.com:application-server:feature_AOS-123-SNAPSHOT",
+		"org.opencontainers.image.base.name":   "docker-registry.themoon.com:5000/aurora/oracle8:1.2.3",
+		"org.opencontainers.image.base.digest": "sha256:2b3a5d5d2c1f1b1e0f6a2c0d8e4f3a1b9c7d5e3f1a2b4c6d8e0f1a3b5c7d9e1f",
+	}, labels)
+}
@@ -0,0 +1,174 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Platform of an image, as in manifest lists and image configs
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ParsePlatform parses a platform on the form os/architecture[/variant], e.g. linux/arm64/v8
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, errors.Errorf("Invalid platform %s. Expected os/architecture[/variant], e.g. linux/amd64", platform)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func (m Platform) String() string {
+	if m.Variant == "" {
+		return m.OS + "/" + m.Architecture
+	}
+	return m.OS + "/" + m.Architecture + "/" + m.Variant
+}
+
+// Matches tells if the platform is the wanted platform. A wanted platform without variant matches all variants.
+func (m Platform) Matches(wanted Platform) bool {
+	return m.OS == wanted.OS && m.Architecture == wanted.Architecture &&
+		(wanted.Variant == "" || m.Variant == wanted.Variant)
+}
+
+// TagSuffix is used to tag the image of one platform, e.g. linux-arm64-v8
+func (m Platform) TagSuffix() string {
+	return strings.Replace(m.String(), "/", "-", -1)
+}
+
+// ManifestDescriptor references the image of one platform in a manifest list
+type ManifestDescriptor struct {
+	Descriptor
+	Platform *Platform `json:"platform,omitempty"`
+}
+
+// ManifestList is a Docker manifest list or an OCI image index
+type ManifestList struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType,omitempty"`
+	Manifests     []ManifestDescriptor `json:"manifests"`
+}
+
+// NewManifestList creates a Docker manifest list of the images
+func NewManifestList(manifests []ManifestDescriptor) *ManifestList {
+	return &ManifestList{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifestList,
+		Manifests:     manifests,
+	}
+}
+
+// GetManifestList returns the manifest list for a tag or digest. The list is nil if the reference is a
+// single image.
+func (m *RegistryApi) GetManifestList(ctx context.Context, repository string, reference string) (*ManifestList, error) {
+	res, err := m.do(ctx, "GET", m.url("/v2/%s/manifests/%s", repository, reference), nil, acceptManifests)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get manifest for %s:%s", repository, reference)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, newRegistryError(res, "Failed to get manifest for %s:%s", repository, reference)
+	}
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read manifest for %s:%s", repository, reference)
+	}
+	list := &ManifestList{}
+	if err := json.Unmarshal(content, list); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal manifest for %s:%s", repository, reference)
+	}
+	// The media type of an OCI index is optional in the document
+	mediaType := list.MediaType
+	if mediaType == "" {
+		mediaType = strings.TrimSpace(strings.Split(res.Header.Get("Content-Type"), ";")[0])
+	}
+	if mediaType != MediaTypeManifestList && mediaType != MediaTypeOCIIndex {
+		return nil, nil
+	}
+	list.MediaType = mediaType
+	return list, nil
+}
+
+// PutManifestList stores the manifest list under the given tag and returns its digest
+func (m *RegistryApi) PutManifestList(ctx context.Context, repository string, reference string, list *ManifestList) (string, error) {
+	content, err := json.Marshal(list)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to marshal manifest list")
+	}
+	contentType := func(req *http.Request) {
+		req.Header.Set("Content-Type", list.MediaType)
+	}
+	res, err := m.do(ctx, "PUT", m.url("/v2/%s/manifests/%s", repository, reference), content, contentType)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to put manifest list %s:%s", repository, reference)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return "", newRegistryError(res, "Failed to put manifest list %s:%s", repository, reference)
+	}
+	return Digest(content), nil
+}
+
+// SetImagePlatform sets the platform in the config of an image. The Docker daemon records its own platform
+// in the config of the images it builds, also when the base image is of another platform. The image is
+// stored again under the same tag, and the descriptor of the new manifest is returned.
+func (m *RegistryApi) SetImagePlatform(ctx context.Context, repository string, reference string, platform Platform) (*ManifestDescriptor, error) {
+	manifest, err := m.GetImageManifest(ctx, repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, errors.Errorf("Image %s:%s does not exist", repository, reference)
+	}
+	content, err := m.GetBlob(ctx, repository, manifest.Config.Digest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get config of %s:%s", repository, reference)
+	}
+	config := make(map[string]interface{})
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal config of %s:%s", repository, reference)
+	}
+	config["os"] = platform.OS
+	config["architecture"] = platform.Architecture
+	if platform.Variant != "" {
+		config["variant"] = platform.Variant
+	} else {
+		delete(config, "variant")
+	}
+	content, err = json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to marshal config of %s:%s", repository, reference)
+	}
+	configDescriptor, err := m.UploadBlob(ctx, repository, manifest.Config.MediaType, content)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.Config = *configDescriptor
+	if manifest.MediaType == "" {
+		manifest.MediaType = MediaTypeManifestV2
+	}
+	content, err = json.Marshal(manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal manifest")
+	}
+	digest, err := m.PutImageManifest(ctx, repository, reference, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestDescriptor{
+		Descriptor: Descriptor{MediaType: manifest.MediaType, Size: int64(len(content)), Digest: digest},
+		Platform:   &platform,
+	}, nil
+}
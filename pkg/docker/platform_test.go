@@ -0,0 +1,128 @@
+package docker_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const baseManifestList = `{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+  "manifests": [
+    {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "size": 528, "digest": "sha256:amd64", "platform": {"architecture": "amd64", "os": "linux"}},
+    {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "size": 528, "digest": "sha256:arm64", "platform": {"architecture": "arm64", "os": "linux", "variant": "v8"}}
+  ]
+}`
+
+// An in-memory registry without authentication, where blobs are uploaded in a single PUT
+func newPlatformRegistry(manifests map[string]string, blobs map[string]string) *httptest.Server {
+	manifestPath := regexp.MustCompile(`^/v2/(.+)/manifests/([^/]+)$`)
+	blobPath := regexp.MustCompile(`^/v2/(.+)/blobs/(sha256:[a-f0-9]+)$`)
+	var mutex sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		if match := manifestPath.FindStringSubmatch(r.URL.Path); match != nil {
+			if r.Method == "PUT" {
+				manifests[match[2]] = string(body)
+				w.WriteHeader(http.StatusCreated)
+			} else if content, ok := manifests[match[2]]; ok {
+				w.Write([]byte(content))
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		} else if match := blobPath.FindStringSubmatch(r.URL.Path); match != nil {
+			if content, ok := blobs[match[2]]; ok {
+				w.Write([]byte(content))
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		} else if strings.HasSuffix(r.URL.Path, "/blobs/uploads/") {
+			w.Header().Set("Location", "/upload/1")
+			w.WriteHeader(http.StatusAccepted)
+		} else if r.URL.Path == "/upload/1" {
+			blobs[r.URL.Query().Get("digest")] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+}
+
+func TestParsePlatform(t *testing.T) {
+	platform, err := docker.ParsePlatform("linux/arm64/v8")
+	assert.NoError(t, err)
+	assert.Equal(t, docker.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, platform)
+	assert.Equal(t, "linux/arm64/v8", platform.String())
+	assert.Equal(t, "linux-arm64-v8", platform.TagSuffix())
+
+	assert.True(t, platform.Matches(docker.Platform{OS: "linux", Architecture: "arm64"}))
+	assert.False(t, platform.Matches(docker.Platform{OS: "linux", Architecture: "arm64", Variant: "v7"}))
+	assert.False(t, platform.Matches(docker.Platform{OS: "linux", Architecture: "amd64"}))
+
+	_, err = docker.ParsePlatform("amd64")
+	assert.Error(t, err)
+}
+
+func TestGetManifestList(t *testing.T) {
+	registry := newPlatformRegistry(map[string]string{
+		"1.0.2":  baseManifestList,
+		"single": `{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json"}`,
+	}, map[string]string{})
+	defer registry.Close()
+	target := docker.NewRegistryApi(registry.URL, nil)
+
+	list, err := target.GetManifestList(context.Background(), "aurora/oracle8", "1.0.2")
+	assert.NoError(t, err)
+	assert.Len(t, list.Manifests, 2)
+	assert.Equal(t, "sha256:arm64", list.Manifests[1].Digest)
+	assert.Equal(t, "v8", list.Manifests[1].Platform.Variant)
+
+	list, err = target.GetManifestList(context.Background(), "aurora/oracle8", "single")
+	assert.NoError(t, err)
+	assert.Nil(t, list)
+}
+
+func TestSetImagePlatformAndPushManifestList(t *testing.T) {
+	config := `{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"}}`
+	manifests := map[string]string{
+		"1.2.3-linux-arm64": `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json",` +
+			`"config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":64,"digest":"` + docker.Digest([]byte(config)) + `"},` +
+			`"layers":[{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","size":1024,"digest":"sha256:layer"}]}`,
+	}
+	blobs := map[string]string{docker.Digest([]byte(config)): config}
+	registry := newPlatformRegistry(manifests, blobs)
+	defer registry.Close()
+	target := docker.NewRegistryApi(registry.URL, nil)
+
+	platform := docker.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	manifest, err := target.SetImagePlatform(context.Background(), "aurora/app", "1.2.3-linux-arm64", platform)
+	assert.NoError(t, err)
+	assert.Equal(t, docker.Digest([]byte(manifests["1.2.3-linux-arm64"])), manifest.Digest)
+	assert.Equal(t, int64(len(manifests["1.2.3-linux-arm64"])), manifest.Size)
+	assert.Equal(t, &platform, manifest.Platform)
+
+	image := docker.ImageManifest{}
+	assert.NoError(t, json.Unmarshal([]byte(manifests["1.2.3-linux-arm64"]), &image))
+	assert.Equal(t, "sha256:layer", image.Layers[0].Digest)
+	imageConfig := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(blobs[image.Config.Digest]), &imageConfig))
+	assert.Equal(t, "arm64", imageConfig["architecture"])
+	assert.Equal(t, "v8", imageConfig["variant"])
+	assert.Equal(t, map[string]interface{}{"type": "layers"}, imageConfig["rootfs"])
+
+	_, err = target.PutManifestList(context.Background(), "aurora/app", "1.2.3", docker.NewManifestList([]docker.ManifestDescriptor{*manifest}))
+	assert.NoError(t, err)
+	list, err := target.GetManifestList(context.Background(), "aurora/app", "1.2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.Digest, list.Manifests[0].Digest)
+	assert.Equal(t, "arm64", list.Manifests[0].Platform.Architecture)
+}
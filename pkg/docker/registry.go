@@ -1,29 +1,89 @@
 package docker
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/docker/image"
 	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/tracing"
+	"github.com/skatteetaten/architect/pkg/util"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"regexp"
 	"strings"
+	"time"
 )
 
 type ImageInfoProvider interface {
-	GetCompleteBaseImageVersion(repository string, tag string) (string, error)
-	GetTags(repository string) (*TagsAPIResponse, error)
-	GetManifestEnvMap(repository string, tag string) (map[string]string, error)
+	GetCompleteBaseImageVersion(ctx context.Context, repository string, tag string) (string, error)
+	GetTags(ctx context.Context, repository string) (*TagsAPIResponse, error)
+	GetManifestEnvMap(ctx context.Context, repository string, tag string) (map[string]string, error)
+	GetImageDigest(ctx context.Context, repository string, tag string) (string, error)
+}
+
+var digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+
+// IsDigest tells if the reference is a content digest, e.g. sha256:<hex>, rather than a tag
+func IsDigest(reference string) bool {
+	return digestPattern.MatchString(reference)
 }
 
 type RegistryClient struct {
 	address string
+	api     *RegistryApi
+	retry   util.RetryPolicy
+}
+
+// NewRegistryClient creates a client for the registry. Requests are authenticated with the credentials, if not nil,
+// when the registry asks for it.
+func NewRegistryClient(address string, retry util.RetryPolicy, credentials *RegistryCredentials) ImageInfoProvider {
+	return &RegistryClient{address: address, api: NewRegistryApi(address, credentials), retry: retry}
+}
+
+// The registries use self signed certificates. There is no overall timeout, as blobs may be large.
+// Requests are cancelled through their context instead.
+func newRegistryHttpClient() *http.Client {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+	}
+	return &http.Client{Transport: tracing.NewTransport(tr)}
+}
+
+// get returns the body of the response. Server errors and dropped connections are retried. Other
+// responses are left to the caller, e.g. the tag list of a new repository is an error document.
+func (registry *RegistryClient) get(ctx context.Context, url string) ([]byte, error) {
+	body, _, err := registry.getPage(ctx, url)
+	return body, err
 }
 
-func NewRegistryClient(address string) ImageInfoProvider {
-	return &RegistryClient{address: address}
+// getPage returns the body of the response as get, and the url of the next page of a list
+func (registry *RegistryClient) getPage(ctx context.Context, url string) ([]byte, string, error) {
+	var body []byte
+	var next string
+	err := registry.retry.Do(ctx, "GET "+url, func() error {
+		res, err := registry.api.do(ctx, "GET", url, nil, nil)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if statusError := util.NewStatusError(res); statusError.Temporary() {
+			return statusError
+		}
+		next = registry.api.nextPage(res.Header)
+		body, err = ioutil.ReadAll(res.Body)
+		return err
+	})
+	return body, next, err
 }
 
 type TagsAPIResponse struct {
@@ -31,28 +91,15 @@ type TagsAPIResponse struct {
 	Tags []string `json:"tags"`
 }
 
-func (registry *RegistryClient) getManifest(repository string, tag string) (*schema1.SignedManifest, error) {
+func (registry *RegistryClient) getManifest(ctx context.Context, repository string, tag string) (*schema1.SignedManifest, error) {
 	url := fmt.Sprintf("%s/v2/%s/manifests/%s", registry.address, repository, tag)
 
-	//TODO! Flytt alle HTTP metoder til felles utility-bibliotek!
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-	res, err := client.Get(url)
+	body, err := registry.get(ctx, url)
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to download manifest for repository %s, tag %s from Docker registry %s", repository, tag, url)
 	}
 
-	body, err := ioutil.ReadAll(res.Body)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to read manifest for repository %s, tag %s from Docker registry %s", repository, tag, url)
-	}
-
-	defer res.Body.Close()
-
 	manifest := &schema1.SignedManifest{}
 
 	if err = manifest.UnmarshalJSON(body); err != nil {
@@ -62,51 +109,76 @@ func (registry *RegistryClient) getManifest(repository string, tag string) (*sch
 	return manifest, nil
 }
 
-func (registry *RegistryClient) GetTags(repository string) (*TagsAPIResponse, error) {
-	url := fmt.Sprintf("%s/v2/%s/tags/list", registry.address, repository)
-	var tagsList TagsAPIResponse
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
+// GetTags lists all tags of the repository. Registries like Docker Hub and Harbor list the tags in pages, so
+// the pages are followed until the last.
+func (registry *RegistryClient) GetTags(ctx context.Context, repository string) (*TagsAPIResponse, error) {
+	url := fmt.Sprintf("%s/v2/%s/tags/list?n=%d", registry.address, repository, listPageSize)
+	tagsList := TagsAPIResponse{Name: repository, Tags: make([]string, 0)}
 
-	res, err := client.Get(url)
+	for url != "" {
+		body, next, err := registry.getPage(ctx, url)
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to download tags for repository %s from Docker registry %s", repository, url)
-	}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to download tags for repository %s from Docker registry %s", repository, url)
+		}
 
-	body, err := ioutil.ReadAll(res.Body)
+		var page TagsAPIResponse
+		err = json.Unmarshal(body, &page)
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to read tags for repository %s from Docker registry %s", repository, url)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to unmarshal tag list for repository %s from Docker registry %s", repository, url)
+		}
+		tagsList.Tags = append(tagsList.Tags, page.Tags...)
+		url = next
 	}
 
-	defer res.Body.Close()
+	return &tagsList, nil
+}
 
-	err = json.Unmarshal(body, &tagsList)
+func (registry *RegistryClient) GetManifestEnvMap(ctx context.Context, repository string, tag string) (map[string]string, error) {
+	if IsDigest(tag) {
+		return registry.getConfigEnvMap(ctx, repository, tag)
+	}
+	manifest, err := registry.getManifest(ctx, repository, tag)
 
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to unmarshal tag list for repository %s from Docker registry %s", repository, url)
+		return nil, errors.Wrap(err, "Failed to get manifest")
 	}
 
-	return &tagsList, nil
+	return getEnvMapFromV1Data(manifest.History[0].V1Compatibility)
 }
 
-func (registry *RegistryClient) GetManifestEnvMap(repository string, tag string) (map[string]string, error) {
-	manifest, err := registry.getManifest(repository, tag)
-
+// The registry only converts manifests to schema 1 when they are referenced by tag, so the env of an image
+// referenced by digest is read from its config. The first image of a manifest list is used.
+func (registry *RegistryClient) getConfigEnvMap(ctx context.Context, repository string, digest string) (map[string]string, error) {
+	var config *ImageConfig
+	err := registry.retry.Do(ctx, "GET config of "+repository+"@"+digest, func() error {
+		var err error
+		config, err = registry.api.GetImageConfig(ctx, repository, digest)
+		return err
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to get manifest")
+		return nil, errors.Wrapf(err, "Failed to get config for repository %s, digest %s from Docker registry %s",
+			repository, digest, registry.address)
 	}
+	return config.EnvMap(), nil
+}
 
-	return getEnvMapFromV1Data(manifest.History[0].V1Compatibility)
+// GetImageDigest returns the digest of the manifest the tag points to, so that the image can be referenced
+// by digest even if the tag is moved
+func (registry *RegistryClient) GetImageDigest(ctx context.Context, repository string, tag string) (string, error) {
+	var digest string
+	err := registry.retry.Do(ctx, "HEAD "+repository+":"+tag, func() error {
+		var err error
+		digest, err = registry.api.GetManifestDigest(ctx, repository, tag)
+		return err
+	})
+	return digest, err
 }
 
-func (registry *RegistryClient) GetCompleteBaseImageVersion(repository string, tag string) (string, error) {
+func (registry *RegistryClient) GetCompleteBaseImageVersion(ctx context.Context, repository string, tag string) (string, error) {
 
-	envMap, err := registry.GetManifestEnvMap(repository, tag)
+	envMap, err := registry.GetManifestEnvMap(ctx, repository, tag)
 
 	if err != nil {
 		return "", errors.Wrap(err, "Unable to get environment map")
@@ -121,7 +193,7 @@ func (registry *RegistryClient) GetCompleteBaseImageVersion(repository string, t
 	if value == "" {
 		return "", errors.Errorf("Failed to extract version in getBaseImageVersion, registry: %s, "+
 			"BaseImage: %s, BaseVersion: %s EnvMap: %v",
-			registry, repository, tag, envMap)
+			registry.address, repository, tag, envMap)
 	}
 	return value, nil
 }
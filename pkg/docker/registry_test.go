@@ -1,12 +1,15 @@
 package docker
 
 import (
+	"context"
 	"fmt"
+	"github.com/skatteetaten/architect/pkg/util"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 const repository = "aurora/oracle8"
@@ -22,9 +25,9 @@ func TestGetManifestEnv(t *testing.T) {
 
 	assert.NoError(t, err)
 
-	target := NewRegistryClient(server.URL)
+	target := NewRegistryClient(server.URL, util.RetryPolicy{}, nil)
 
-	manifestEnvMap, err := target.GetManifestEnvMap("aurora/oracle8", "1")
+	manifestEnvMap, err := target.GetManifestEnvMap(context.Background(), "aurora/oracle8", "1")
 	assert.NoError(t, err)
 	actualVersion := manifestEnvMap["BASE_IMAGE_VERSION"]
 	assert.Equal(t, actualVersion, expected_version)
@@ -38,9 +41,9 @@ func TestGetManifestEnvMap(t *testing.T) {
 
 	assert.NoError(t, err)
 
-	target := NewRegistryClient(server.URL)
+	target := NewRegistryClient(server.URL, util.RetryPolicy{}, nil)
 
-	envMap, err := target.GetManifestEnvMap("aurora/oracle8", "1")
+	envMap, err := target.GetManifestEnvMap(context.Background(), "aurora/oracle8", "1")
 
 	assert.NoError(t, err)
 
@@ -60,15 +63,100 @@ func TestGetTags(t *testing.T) {
 		"develop-SNAPSHOT-9be2b9ca43a024415947a6c262e183406dbb090b",
 		"2.0.0", "1.3.0", "1.2.1", "1.1.2", "1.1", "1.2", "1.3", "2.0", "2", "1"}
 
-	target := NewRegistryClient(server.URL)
+	target := NewRegistryClient(server.URL, util.RetryPolicy{}, nil)
 
-	tags, err := target.GetTags("aurora/oracle8")
+	tags, err := target.GetTags(context.Background(), "aurora/oracle8")
 
 	assert.NoError(t, err)
 
 	verifyTagListContent(tags.Tags, expectedTags, t)
 }
 
+func TestGetTagsFollowsPages(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/aurora/oracle8/tags/list?last=1.2.0&n=2>; rel="next"`)
+			w.Write([]byte(`{"name": "aurora/oracle8", "tags": ["1.1.0", "1.2.0"]}`))
+			return
+		}
+		w.Write([]byte(`{"name": "aurora/oracle8", "tags": ["1.2.5", "latest"]}`))
+	}))
+	defer server.Close()
+
+	target := NewRegistryClient(server.URL, util.RetryPolicy{}, nil)
+
+	tags, err := target.GetTags(context.Background(), "aurora/oracle8")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.1.0", "1.2.0", "1.2.5", "latest"}, tags.Tags)
+}
+
+func TestGetTagsRetriesServerErrors(t *testing.T) {
+	server, requests, err := startFlakyRegistryServer("testdata/tags.list.json", 2)
+	defer server.Close()
+	assert.NoError(t, err)
+
+	target := NewRegistryClient(server.URL, util.RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}, nil)
+
+	tags, err := target.GetTags(context.Background(), "aurora/oracle8")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, *requests)
+	assert.Contains(t, tags.Tags, "2.0.0")
+}
+
+func TestGetTagsGivesUpAfterAttempts(t *testing.T) {
+	server, requests, err := startFlakyRegistryServer("testdata/tags.list.json", 5)
+	defer server.Close()
+	assert.NoError(t, err)
+
+	target := NewRegistryClient(server.URL, util.RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}, nil)
+
+	_, err = target.GetTags(context.Background(), "aurora/oracle8")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "502")
+	assert.Equal(t, 3, *requests)
+}
+
+func TestIsDigest(t *testing.T) {
+	assert.True(t, IsDigest("sha256:2b3a5d5d2c1f1b1e0f6a2c0d8e4f3a1b9c7d5e3f1a2b4c6d8e0f1a3b5c7d9e1f"))
+	assert.False(t, IsDigest("1.7.0"))
+	assert.False(t, IsDigest("sha256:short"))
+}
+
+func TestGetImageDigestAndEnvByDigest(t *testing.T) {
+	config := []byte(`{"config": {"Env": ["BASE_IMAGE_VERSION=1.7.0", "TZ=Europe/Oslo"]}}`)
+	configDigest := Digest(config)
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion": 2, "mediaType": "%s", "config": {"mediaType": "application/vnd.docker.container.image.v1+json", "digest": "%s", "size": %d}}`,
+		MediaTypeManifestV2, configDigest, len(config)))
+	manifestDigest := Digest(manifest)
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/aurora/oracle8/manifests/1.7.0", "/v2/aurora/oracle8/manifests/" + manifestDigest:
+			w.Header().Set("Content-Type", MediaTypeManifestV2)
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			w.Write(manifest)
+		case "/v2/aurora/oracle8/blobs/" + configDigest:
+			w.Write(config)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	target := NewRegistryClient(ts.URL, util.RetryPolicy{}, nil)
+
+	digest, err := target.GetImageDigest(context.Background(), "aurora/oracle8", "1.7.0")
+	assert.NoError(t, err)
+	assert.Equal(t, manifestDigest, digest)
+
+	version, err := target.GetCompleteBaseImageVersion(context.Background(), "aurora/oracle8", digest)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.7.0", version)
+}
+
 func verifyTagListContent(actualList []string, expectedList []string, t *testing.T) {
 	if len(actualList) != len(expectedList) {
 		t.Errorf("Expected %d tags, actual is %d", len(expectedList), len(actualList))
@@ -110,3 +198,25 @@ func startMockRegistryServer(filename string) (*httptest.Server, error) {
 	ts.StartTLS()
 	return ts, nil
 }
+
+// startFlakyRegistryServer responds with 502 Bad Gateway to the first failures requests
+func startFlakyRegistryServer(filename string, failures int) (*httptest.Server, *int, error) {
+	buf, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requests := 0
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(buf)
+	}))
+	ts.StartTLS()
+	return ts, &requests, nil
+}
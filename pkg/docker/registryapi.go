@@ -0,0 +1,536 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	MediaTypeManifestV2   = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestMediaTypes = []string{MediaTypeManifestV2, MediaTypeManifestList, MediaTypeOCIManifest, MediaTypeOCIIndex}
+
+var challengeParameter = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// RegistryApi is a client for the parts of the Docker registry v2 API that are not covered by the Docker daemon,
+// like resolving manifest digests and storing artifacts next to images.
+//
+// Requests are authenticated with basic auth or a bearer token, depending on the challenge from the registry.
+// Bearer tokens are scoped to a repository, so they are cached per repository. The client may be used by several
+// goroutines at the same time.
+type RegistryApi struct {
+	address     string
+	credentials *RegistryCredentials
+	client      *http.Client
+	mutex       sync.Mutex
+	tokens      map[string]string
+}
+
+// NewRegistryApi creates a client for the registry. The address may be given without protocol, as in the
+// output registry of the build, in which case https is used.
+func NewRegistryApi(address string, credentials *RegistryCredentials) *RegistryApi {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "https://" + address
+	}
+	return &RegistryApi{
+		address:     strings.TrimSuffix(address, "/"),
+		credentials: credentials,
+		client:      newRegistryHttpClient(),
+		tokens:      make(map[string]string),
+	}
+}
+
+// Descriptor references content in the registry, as used in manifests
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ImageManifest is a Docker v2 schema 2 or OCI image manifest
+type ImageManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Digest returns the digest of the content in the form used by the registry, e.g. sha256:<hex>
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// GetManifestDigest returns the digest of the manifest a tag points to
+func (m *RegistryApi) GetManifestDigest(ctx context.Context, repository string, reference string) (string, error) {
+	res, err := m.do(ctx, "HEAD", m.url("/v2/%s/manifests/%s", repository, reference), nil, acceptManifests)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get manifest digest for %s:%s", repository, reference)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", newRegistryError(res, "Failed to get manifest digest for %s:%s", repository, reference)
+	}
+	digest := res.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.Errorf("Registry did not return a digest for %s:%s", repository, reference)
+	}
+	return digest, nil
+}
+
+// GetImageManifest returns the manifest for a tag or digest. The manifest is nil if it does not exist.
+func (m *RegistryApi) GetImageManifest(ctx context.Context, repository string, reference string) (*ImageManifest, error) {
+	res, err := m.do(ctx, "GET", m.url("/v2/%s/manifests/%s", repository, reference), nil, acceptManifests)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get manifest for %s:%s", repository, reference)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if res.StatusCode != http.StatusOK {
+		return nil, newRegistryError(res, "Failed to get manifest for %s:%s", repository, reference)
+	}
+	manifest := &ImageManifest{}
+	if err := json.NewDecoder(res.Body).Decode(manifest); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal manifest for %s:%s", repository, reference)
+	}
+	return manifest, nil
+}
+
+// PutImageManifest stores the manifest under the given tag and returns its digest
+func (m *RegistryApi) PutImageManifest(ctx context.Context, repository string, reference string, manifest *ImageManifest) (string, error) {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to marshal manifest")
+	}
+	contentType := func(req *http.Request) {
+		req.Header.Set("Content-Type", manifest.MediaType)
+	}
+	res, err := m.do(ctx, "PUT", m.url("/v2/%s/manifests/%s", repository, reference), content, contentType)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to put manifest %s:%s", repository, reference)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return "", newRegistryError(res, "Failed to put manifest %s:%s", repository, reference)
+	}
+	return Digest(content), nil
+}
+
+// GetBlob downloads a blob and verifies its digest
+func (m *RegistryApi) GetBlob(ctx context.Context, repository string, digest string) ([]byte, error) {
+	res, err := m.do(ctx, "GET", m.url("/v2/%s/blobs/%s", repository, digest), nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get blob %s in %s", digest, repository)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, newRegistryError(res, "Failed to get blob %s in %s", digest, repository)
+	}
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read blob %s in %s", digest, repository)
+	}
+	if Digest(content) != digest {
+		return nil, errors.Errorf("Blob %s in %s does not match its digest", digest, repository)
+	}
+	return content, nil
+}
+
+// Ping checks that the registry is up. The request is not authenticated, as a registry that asks for
+// credentials is up.
+func (m *RegistryApi) Ping(ctx context.Context) error {
+	req, err := http.NewRequest("GET", m.url("/v2/"), nil)
+	if err != nil {
+		return err
+	}
+	res, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to reach registry %s", m.address)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusUnauthorized {
+		return newRegistryError(res, "Registry %s is not available", m.address)
+	}
+	return nil
+}
+
+// GetCatalog returns the repositories in the registry
+func (m *RegistryApi) GetCatalog(ctx context.Context) ([]string, error) {
+	repositories := make([]string, 0)
+	err := m.list(ctx, m.url("/v2/_catalog?n=%d", listPageSize), func(content []byte) error {
+		page := struct {
+			Repositories []string `json:"repositories"`
+		}{}
+		if err := json.Unmarshal(content, &page); err != nil {
+			return errors.Wrap(err, "Failed to unmarshal catalog")
+		}
+		repositories = append(repositories, page.Repositories...)
+		return nil
+	})
+	return repositories, err
+}
+
+// ListTags returns the tags of a repository
+func (m *RegistryApi) ListTags(ctx context.Context, repository string) ([]string, error) {
+	tags := make([]string, 0)
+	err := m.list(ctx, m.url("/v2/%s/tags/list?n=%d", repository, listPageSize), func(content []byte) error {
+		page := TagsAPIResponse{}
+		if err := json.Unmarshal(content, &page); err != nil {
+			return errors.Wrapf(err, "Failed to unmarshal tags of %s", repository)
+		}
+		tags = append(tags, page.Tags...)
+		return nil
+	})
+	return tags, err
+}
+
+const listPageSize = 1000
+
+var nextLink = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="next"`)
+
+// list gets each page of a paginated list, following the Link header of the registry
+func (m *RegistryApi) list(ctx context.Context, url string, page func(content []byte) error) error {
+	for url != "" {
+		res, err := m.do(ctx, "GET", url, nil, nil)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get %s", url)
+		}
+		if res.StatusCode != http.StatusOK {
+			err := newRegistryError(res, "Failed to get %s", url)
+			res.Body.Close()
+			return err
+		}
+		content, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read %s", url)
+		}
+		if err := page(content); err != nil {
+			return err
+		}
+		url = m.nextPage(res.Header)
+	}
+	return nil
+}
+
+// nextPage returns the url of the next page of a list from the Link header, or an empty string on the last page
+func (m *RegistryApi) nextPage(header http.Header) string {
+	match := nextLink.FindStringSubmatch(header.Get("Link"))
+	if match == nil {
+		return ""
+	}
+	if strings.HasPrefix(match[1], "/") {
+		return m.address + match[1]
+	}
+	return match[1]
+}
+
+// ImageConfig is the container config in the config blob of an image
+type ImageConfig struct {
+	Env    []string          `json:"Env"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// EnvMap returns the env of the image by name
+func (m *ImageConfig) EnvMap() map[string]string {
+	env := make(map[string]string)
+	for _, entry := range m.Env {
+		keyValue := strings.SplitN(entry, "=", 2)
+		if len(keyValue) == 2 {
+			env[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+		}
+	}
+	return env
+}
+
+// GetImageConfig returns the container config of an image by tag or digest. For a manifest list, the config of
+// the first image is returned, as the images of the platforms are built alike.
+func (m *RegistryApi) GetImageConfig(ctx context.Context, repository string, reference string) (*ImageConfig, error) {
+	list, err := m.GetManifestList(ctx, repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	imageReference := reference
+	if list != nil {
+		if len(list.Manifests) == 0 {
+			return nil, errors.Errorf("Manifest list %s:%s is empty", repository, reference)
+		}
+		imageReference = list.Manifests[0].Digest
+	}
+	manifest, err := m.GetImageManifest(ctx, repository, imageReference)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, errors.Errorf("Image %s:%s does not exist", repository, reference)
+	}
+	content, err := m.GetBlob(ctx, repository, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	document := struct {
+		Config ImageConfig `json:"config"`
+	}{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal config of %s:%s", repository, reference)
+	}
+	return &document.Config, nil
+}
+
+// UploadBlob uploads the content as a blob, unless it already exists. Returns a descriptor of the blob.
+func (m *RegistryApi) UploadBlob(ctx context.Context, repository string, mediaType string, content []byte) (*Descriptor, error) {
+	descriptor := &Descriptor{
+		MediaType: mediaType,
+		Size:      int64(len(content)),
+		Digest:    Digest(content),
+	}
+
+	res, err := m.do(ctx, "HEAD", m.url("/v2/%s/blobs/%s", repository, descriptor.Digest), nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to check blob %s in %s", descriptor.Digest, repository)
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		logrus.Debugf("Blob %s already exists in %s", descriptor.Digest, repository)
+		return descriptor, nil
+	}
+
+	res, err = m.do(ctx, "POST", m.url("/v2/%s/blobs/uploads/", repository), nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to start blob upload in %s", repository)
+	}
+	if res.StatusCode != http.StatusAccepted {
+		defer res.Body.Close()
+		return nil, newRegistryError(res, "Failed to start blob upload in %s", repository)
+	}
+	res.Body.Close()
+
+	location, err := m.uploadLocation(res.Header.Get("Location"), descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+	contentType := func(req *http.Request) {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	res, err = m.do(ctx, "PUT", location, content, contentType)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to upload blob %s to %s", descriptor.Digest, repository)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return nil, newRegistryError(res, "Failed to upload blob %s to %s", descriptor.Digest, repository)
+	}
+	return descriptor, nil
+}
+
+// The location of an upload may be relative to the registry and may already have query parameters
+func (m *RegistryApi) uploadLocation(location string, digest string) (string, error) {
+	if location == "" {
+		return "", errors.New("Registry did not return an upload location")
+	}
+	base, err := url.Parse(m.address)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid registry address %s", m.address)
+	}
+	u, err := base.Parse(location)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid upload location %s", location)
+	}
+	query := u.Query()
+	query.Set("digest", digest)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (m *RegistryApi) url(format string, a ...interface{}) string {
+	return m.address + fmt.Sprintf(format, a...)
+}
+
+func acceptManifests(req *http.Request) {
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+}
+
+// do performs the request, and retries it once with authentication if the registry responds with a challenge
+func (m *RegistryApi) do(ctx context.Context, method string, url string, body []byte, decorate func(*http.Request)) (*http.Response, error) {
+	scope := tokenScope(url)
+	newRequest := func(token string) (*http.Request, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, url, reader)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if decorate != nil {
+			decorate(req)
+		}
+		m.authorize(req, token)
+		return req, nil
+	}
+
+	req, err := newRequest(m.token(scope))
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.client.Do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	res.Body.Close()
+
+	// The request is retried with the token it got, even if another request replaces the token of the scope
+	token, err := m.authenticate(ctx, res.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		m.mutex.Lock()
+		m.tokens[scope] = token
+		m.mutex.Unlock()
+	}
+	req, err = newRequest(token)
+	if err != nil {
+		return nil, err
+	}
+	return m.client.Do(req)
+}
+
+func (m *RegistryApi) token(scope string) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.tokens[scope]
+}
+
+// tokenScope returns the repository of a request, as the registry gives tokens for a repository. Requests that
+// are not for a repository, like the catalog, are scoped by their path.
+func tokenScope(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	path := strings.TrimPrefix(u.Path, "/v2/")
+	for _, separator := range []string{"/manifests/", "/blobs/", "/tags/"} {
+		if i := strings.Index(path, separator); i >= 0 {
+			return path[:i]
+		}
+	}
+	return path
+}
+
+func (m *RegistryApi) authorize(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if m.credentials != nil && m.credentials.RegistryToken != "" {
+		req.Header.Set("Authorization", "Bearer "+m.credentials.RegistryToken)
+	} else if m.credentials != nil && m.credentials.Username != "" {
+		req.SetBasicAuth(m.credentials.Username, m.credentials.Password)
+	}
+}
+
+// authenticate handles a basic or bearer token challenge, see https://docs.docker.com/registry/spec/auth/token/.
+// Returns the bearer token, or an empty token for basic auth.
+func (m *RegistryApi) authenticate(ctx context.Context, challenge string) (string, error) {
+	if strings.HasPrefix(strings.ToLower(challenge), "basic") {
+		if m.credentials == nil {
+			return "", errors.Errorf("Registry %s requires credentials", m.address)
+		}
+		return "", nil
+	}
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer") {
+		return "", errors.Errorf("Unsupported authentication challenge from registry %s: %s", m.address, challenge)
+	}
+
+	parameters := make(map[string]string)
+	for _, match := range challengeParameter.FindAllStringSubmatch(challenge, -1) {
+		parameters[match[1]] = match[2]
+	}
+	realm, ok := parameters["realm"]
+	if !ok {
+		return "", errors.Errorf("No realm in authentication challenge from registry %s", m.address)
+	}
+	tokenUrl, err := url.Parse(realm)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid realm %s", realm)
+	}
+	query := tokenUrl.Query()
+	for _, key := range []string{"service", "scope"} {
+		if value, ok := parameters[key]; ok {
+			query.Set(key, value)
+		}
+	}
+
+	// An identity token is exchanged for an access token with OAuth2, see https://docs.docker.com/registry/spec/auth/oauth/
+	var req *http.Request
+	if m.credentials != nil && m.credentials.IdentityToken != "" {
+		form := url.Values{}
+		for key, value := range query {
+			form[key] = value
+		}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", m.credentials.IdentityToken)
+		form.Set("client_id", "architect")
+		tokenUrl.RawQuery = ""
+		req, err = http.NewRequest("POST", tokenUrl.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		tokenUrl.RawQuery = query.Encode()
+		req, err = http.NewRequest("GET", tokenUrl.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if m.credentials != nil && m.credentials.Username != "" {
+			req.SetBasicAuth(m.credentials.Username, m.credentials.Password)
+		}
+	}
+	req = req.WithContext(ctx)
+	res, err := m.client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get token from %s", realm)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", newRegistryError(res, "Failed to get token from %s", realm)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", errors.Wrapf(err, "Failed to unmarshal token from %s", realm)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+func newRegistryError(res *http.Response, format string, a ...interface{}) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return errors.Errorf("%s: %s %s", fmt.Sprintf(format, a...), res.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,62 @@
+package docker_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTokenRegistry starts a registry that gives a bearer token for each repository, like Docker Hub and Harbor.
+// The tags of a repository are only listed with the token of that repository.
+func startTokenRegistry() *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			// Slow token requests, so that requests for other repositories are done in the meantime
+			time.Sleep(10 * time.Millisecond)
+			scope := strings.Split(r.URL.Query().Get("scope"), ":")
+			json.NewEncoder(w).Encode(map[string]string{"token": "token-" + scope[1]})
+			return
+		}
+		repository := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/tags/list")
+		if r.Header.Get("Authorization") != "Bearer token-"+repository {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:%s:pull"`,
+				server.URL, repository))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(docker.TagsAPIResponse{Name: repository, Tags: []string{repository + "-1.0.0"}})
+	}))
+	return server
+}
+
+func TestRegistryApiTokensForConcurrentRepositories(t *testing.T) {
+	server := startTokenRegistry()
+	defer server.Close()
+	registry := docker.NewRegistryApi(server.URL, &docker.RegistryCredentials{Username: "foo", Password: "bar"})
+
+	var wait sync.WaitGroup
+	errs := make([]error, 20)
+	tags := make([][]string, 20)
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			tags[i], errs[i] = registry.ListTags(context.Background(), fmt.Sprintf("aurora/app%d", i%5))
+		}(i)
+	}
+	wait.Wait()
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, []string{fmt.Sprintf("aurora/app%d-1.0.0", i%5)}, tags[i])
+	}
+}
@@ -0,0 +1,143 @@
+package docker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// Build output may have very long lines, e.g. from RUN steps that print minified files
+const maxStreamLineSize = 10 * 1024 * 1024
+
+// UnauthorizedError is returned when the registry rejects the credentials, or no credentials are given
+type UnauthorizedError struct {
+	Image   string
+	Message string
+}
+
+func (m *UnauthorizedError) Error() string {
+	return fmt.Sprintf("Not authorized to access %s: %s", m.Image, m.Message)
+}
+
+// ImageNotFoundError is returned when an image to pull or push does not exist
+type ImageNotFoundError struct {
+	Image   string
+	Message string
+}
+
+func (m *ImageNotFoundError) Error() string {
+	return fmt.Sprintf("Image %s not found: %s", m.Image, m.Message)
+}
+
+// BuildStepError is returned when a step in the Dockerfile fails. Step is the step as reported by
+// Docker, e.g. "Step 3 : RUN cat echome.txt", and is empty if the build failed before the first step.
+type BuildStepError struct {
+	Step    string
+	Message string
+}
+
+func (m *BuildStepError) Error() string {
+	if m.Step == "" {
+		return m.Message
+	}
+	return fmt.Sprintf("%s failed: %s", m.Step, m.Message)
+}
+
+func IsUnauthorized(err error) bool {
+	_, ok := errors.Cause(err).(*UnauthorizedError)
+	return ok
+}
+
+func IsImageNotFound(err error) bool {
+	_, ok := errors.Cause(err).(*ImageNotFoundError)
+	return ok
+}
+
+func IsBuildStepError(err error) bool {
+	_, ok := errors.Cause(err).(*BuildStepError)
+	return ok
+}
+
+// readJSONMessages reads the progress stream of a pull, push or build, and calls handle for each message.
+// The stream is newline delimited, and lines that are not valid JSON are logged and skipped.
+// Returns the first error message in the stream.
+func readJSONMessages(stream io.Reader, handle func(message *jsonmessage.JSONMessage)) error {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		message := &jsonmessage.JSONMessage{}
+		if err := json.Unmarshal([]byte(line), message); err != nil {
+			logrus.Debugf("Skipping unexpected output from Docker: %s", line)
+			continue
+		}
+		if message.Error != nil {
+			return message.Error
+		}
+		if message.ErrorMessage != "" {
+			return &jsonmessage.JSONError{Message: message.ErrorMessage}
+		}
+		handle(message)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "Failed to read output from Docker")
+	}
+	return nil
+}
+
+// logProgress logs pull and push progress at debug level, as there is a message for each chunk of each layer
+func logProgress(message *jsonmessage.JSONMessage) {
+	if message.Stream != "" {
+		logrus.Debug(strings.TrimRight(message.Stream, "\r\n"))
+	} else if message.Status != "" && message.ID != "" {
+		logrus.Debugf("%s: %s %s", message.ID, message.Status, message.ProgressMessage)
+	} else if message.Status != "" {
+		logrus.Debug(message.Status)
+	}
+}
+
+// logBuildOutput renders the output of the Dockerfile steps in the build log
+func logBuildOutput(message *jsonmessage.JSONMessage) {
+	for _, line := range strings.Split(strings.TrimRight(message.Stream, "\r\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			logrus.WithField("phase", "build").Info(strings.TrimRight(line, "\r"))
+		}
+	}
+}
+
+// registryError gives errors from pull and push a type, so that the caller can tell why they failed.
+// The daemon only reports the registry response as a message.
+func registryError(image string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if client.IsErrUnauthorized(err) {
+		return &UnauthorizedError{Image: image, Message: err.Error()}
+	}
+	if client.IsErrImageNotFound(err) {
+		return &ImageNotFoundError{Image: image, Message: err.Error()}
+	}
+	jsonError, ok := err.(*jsonmessage.JSONError)
+	if !ok {
+		return err
+	}
+	message := strings.ToLower(jsonError.Message)
+	switch {
+	case jsonError.Code == 401 || strings.Contains(message, "unauthorized") ||
+		strings.Contains(message, "authentication required") || strings.Contains(message, "denied"):
+		return &UnauthorizedError{Image: image, Message: jsonError.Message}
+	case jsonError.Code == 404 || strings.Contains(message, "not found") ||
+		strings.Contains(message, "manifest unknown") || strings.Contains(message, "does not exist"):
+		return &ImageNotFoundError{Image: image, Message: jsonError.Message}
+	}
+	return jsonError
+}
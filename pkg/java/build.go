@@ -16,7 +16,7 @@ func Prepper() process.Prepper {
 		baseImage runtime.DockerImage) ([]docker.DockerBuildConfig, error) {
 
 		logrus.Debug("Prepare output image")
-		buildPath, err := prepare.Prepare(cfg.DockerSpec, auroraVersion, deliverable, baseImage)
+		buildPath, err := prepare.Prepare(cfg, auroraVersion, deliverable, baseImage)
 
 		if err != nil {
 			return nil, errors.Wrap(err, "Error prepare artifact")
@@ -21,6 +21,10 @@ const ApplicationFolder = "application"
 // The directory where the application is prepared
 const ApplicationBuildFolder = ApplicationRoot + "/" + ApplicationFolder
 
+// The path of the SBOM in the image, as the application root is copied to $HOME. Docker expands $HOME in
+// the label with the env of the base image
+const SbomImagePath = "$HOME/architect/sbom.json"
+
 var dockerfileTemplate string = `FROM {{.BaseImage}}
 
 MAINTAINER {{.Maintainer}}
@@ -72,13 +76,18 @@ func createEnv(auroraVersion runtime.AuroraVersion, pushextratags global.PushExt
 	return env
 }
 
-func createLabels(meta config.DeliverableMetadata) map[string]string {
+// The provenance labels are added last, so that they can not be overridden by the deliverable
+func createLabels(meta config.DeliverableMetadata, provenanceLabels map[string]string) map[string]string {
 	var labels map[string]string = make(map[string]string)
 
 	for k, v := range meta.Docker.Labels {
 		labels[k] = v
 	}
 
+	for k, v := range provenanceLabels {
+		labels[k] = v
+	}
+
 	return labels
 }
 
@@ -94,7 +103,7 @@ func verifyMetadata(meta config.DeliverableMetadata) error {
 }
 
 func NewDockerfile(dockerSpec global.DockerSpec, auroraVersion runtime.AuroraVersion, meta config.DeliverableMetadata,
-	baseImage runtime.DockerImage, imageBuildTime string) util.WriterFunc {
+	baseImage runtime.DockerImage, imageBuildTime string, provenanceLabels map[string]string) util.WriterFunc {
 	return func(writer io.Writer) error {
 
 		if err := verifyMetadata(meta); err != nil {
@@ -104,7 +113,7 @@ func NewDockerfile(dockerSpec global.DockerSpec, auroraVersion runtime.AuroraVer
 		data := &DockerfileData{
 			BaseImage:  baseImage.GetCompleteDockerTagName(),
 			Maintainer: meta.Docker.Maintainer,
-			Labels:     createLabels(meta),
+			Labels:     createLabels(meta, provenanceLabels),
 			Env:        createEnv(auroraVersion, dockerSpec.PushExtraTags, meta, imageBuildTime),
 		}
 
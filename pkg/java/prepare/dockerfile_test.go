@@ -13,7 +13,7 @@ import (
 const expectedDockerfile = `FROM oracle8:2.3.2
 
 MAINTAINER wrench@sits.no
-LABEL jallaball="Spank me beibi" maintainer="wrench.sits.no" no.skatteetaten.test="TestLabel"
+LABEL jallaball="Spank me beibi" maintainer="architect" no.skatteetaten.test="TestLabel" org.opencontainers.image.version="2.0.0-SNAPSHOT"
 
 COPY ./app $HOME
 RUN chmod -R 777 $HOME && \
@@ -26,7 +26,7 @@ ENV APP_VERSION="2.0.0-SNAPSHOT" AURORA_VERSION="2.0.0-SNAPSHOT-bbuildimage-orac
 
 func TestBuild(t *testing.T) {
 	dockerSpec := global.DockerSpec{
-		PushExtraTags: global.ParseExtraTags("major"),
+		PushExtraTags: global.PushExtraTags{Major: true},
 	}
 	baseImage := runtime.DockerImage{
 		Tag:        "2.3.2",
@@ -51,7 +51,12 @@ func TestBuild(t *testing.T) {
 			Labels:     labels,
 		},
 	}
-	writer := prepare.NewDockerfile(dockerSpec, *auroraVersions, deliverableMetadata, baseImage, "2017-09-10T14:30:10Z")
+	provenanceLabels := map[string]string{
+		"org.opencontainers.image.version": "2.0.0-SNAPSHOT",
+		"maintainer":                       "architect",
+	}
+	writer := prepare.NewDockerfile(dockerSpec, *auroraVersions, deliverableMetadata, baseImage, "2017-09-10T14:30:10Z",
+		provenanceLabels)
 
 	buffer := new(bytes.Buffer)
 
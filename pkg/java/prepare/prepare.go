@@ -1,6 +1,7 @@
 package prepare
 
 import (
+	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 	"github.com/skatteetaten/architect/pkg/config"
 	"github.com/skatteetaten/architect/pkg/config/runtime"
@@ -8,7 +9,9 @@ import (
 	deliverable "github.com/skatteetaten/architect/pkg/java/config"
 	"github.com/skatteetaten/architect/pkg/java/prepare/resources"
 	"github.com/skatteetaten/architect/pkg/nexus"
+	"github.com/skatteetaten/architect/pkg/sbom"
 	"github.com/skatteetaten/architect/pkg/util"
+	"github.com/skatteetaten/architect/pkg/vulnerability"
 	"io"
 	"io/ioutil"
 	"os"
@@ -20,7 +23,7 @@ type FileGenerator interface {
 	Write(writer io.Writer) error
 }
 
-func Prepare(dockerSpec config.DockerSpec, auroraVersions *runtime.AuroraVersion, deliverable nexus.Deliverable, baseImage runtime.DockerImage) (string, error) {
+func Prepare(cfg *config.Config, auroraVersions *runtime.AuroraVersion, deliverable nexus.Deliverable, baseImage runtime.DockerImage) (string, error) {
 
 	// Create docker build folder
 	dockerBuildPath, err := ioutil.TempDir("", "deliverable")
@@ -54,10 +57,34 @@ func Prepare(dockerSpec config.DockerSpec, auroraVersions *runtime.AuroraVersion
 		return "", errors.Wrap(err, "Failed to prepare application")
 	}
 
-	// Dockerfile
 	fileWriter := util.NewFileWriter(dockerBuildPath)
 
-	if err = fileWriter(NewDockerfile(dockerSpec, *auroraVersions, *meta, baseImage, docker.GetUtcTimestamp()),
+	imageBuildTime := docker.GetUtcTimestamp()
+	provenanceLabels := docker.CreateProvenanceLabels(cfg, auroraVersions, baseImage, imageBuildTime)
+
+	// Dependencies
+	libPath, err := findLibraryPath(applicationFolder)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to locate lib directory in application")
+	}
+	components, err := sbom.FromJars(libPath)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to list dependencies")
+	}
+
+	if err := checkVulnerabilities(cfg.VulnerabilitySpec, components); err != nil {
+		return "", errors.Wrap(err, "Vulnerability check failed")
+	}
+
+	// Software bill of materials
+	if err := addBillOfMaterials(fileWriter, components, cfg, auroraVersions, imageBuildTime); err != nil {
+		return "", errors.Wrap(err, "Failed to create software bill of materials")
+	}
+	provenanceLabels[docker.LABEL_SBOM] = SbomImagePath
+
+	// Dockerfile
+
+	if err = fileWriter(NewDockerfile(cfg.DockerSpec, *auroraVersions, *meta, baseImage, imageBuildTime, provenanceLabels),
 		"Dockerfile"); err != nil {
 		return "", errors.Wrap(err, "Failed to create Dockerfile")
 	}
@@ -65,6 +92,25 @@ func Prepare(dockerSpec config.DockerSpec, auroraVersions *runtime.AuroraVersion
 	return dockerBuildPath, nil
 }
 
+func checkVulnerabilities(spec config.VulnerabilitySpec, components []sbom.Component) error {
+	gate, err := vulnerability.NewGate(spec)
+	if err != nil {
+		return err
+	} else if gate == nil {
+		logrus.Debug("No vulnerability database configured")
+		return nil
+	}
+	return gate.Check(components)
+}
+
+// The bill of materials is written to app/architect, which is $HOME/architect in the image
+func addBillOfMaterials(fileWriter util.FileWriter, components []sbom.Component, cfg *config.Config,
+	auroraVersion *runtime.AuroraVersion, imageBuildTime string) error {
+	application := sbom.NewApplicationComponent(cfg.ApplicationSpec.MavenGav, string(auroraVersion.GetAppVersion()))
+	bom := sbom.NewBom(application, components, imageBuildTime)
+	return fileWriter(sbom.NewBomWriter(bom), "app", "architect", "sbom.json")
+}
+
 func extractAndRenameDeliverable(dockerBuildFolder string, deliverablePath string) error {
 
 	applicationRoot := filepath.Join(dockerBuildFolder, ApplicationRoot)
@@ -6,6 +6,7 @@ import (
 	"github.com/skatteetaten/architect/pkg/java/prepare"
 	"github.com/skatteetaten/architect/pkg/nexus"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -18,7 +19,7 @@ func TestPrepare(t *testing.T) {
 		"2.0.0",
 		"2.0.0-b1.11.0-oracle8-1.0.2")
 
-	dockerBuildPath, err := prepare.Prepare(global.DockerSpec{}, auroraVersions,
+	dockerBuildPath, err := prepare.Prepare(&global.Config{}, auroraVersions,
 		nexus.Deliverable{"testdata/minarch-1.2.22-Leveransepakke.zip"},
 		runtime.DockerImage{
 			Repository: "test",
@@ -28,7 +29,7 @@ func TestPrepare(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test image scripts
-	for _, script := range []string{"logback.xml", "run_tools.sh", "liveness_std.sh", "readiness_std.sh"} {
+	for _, script := range []string{"logback.xml", "run_tools.sh", "liveness_std.sh", "readiness_std.sh", "sbom.json"} {
 		scripPath := filepath.Join(dockerBuildPath, "app", "architect", script)
 		scriptExists, err := prepare.Exists(scripPath)
 
@@ -45,6 +46,9 @@ func TestPrepare(t *testing.T) {
 	} else if !fileExists {
 		t.Errorf("Expected file %s not found", filePath)
 	}
+	dockerfile, err := ioutil.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(dockerfile), `architect.sbom="$HOME/architect/sbom.json"`)
 
 	// Application
 	applicationPath := filepath.Join(dockerBuildPath, "app", "application")
@@ -59,3 +63,37 @@ func TestPrepare(t *testing.T) {
 	os.RemoveAll(dockerBuildPath)
 
 }
+
+func TestPrepareFailsOnVulnerableDependency(t *testing.T) {
+	auroraVersions := runtime.NewAuroraVersion(
+		"2.0.0",
+		true,
+		"2.0.0",
+		"2.0.0-b1.11.0-oracle8-1.0.2")
+
+	cfg := &global.Config{
+		VulnerabilitySpec: global.VulnerabilitySpec{
+			DatabaseFile: "testdata/vulnerabilities.csv",
+		},
+	}
+	_, err := prepare.Prepare(cfg, auroraVersions,
+		nexus.Deliverable{Path: "testdata/minarch-1.2.22-Leveransepakke.zip"},
+		runtime.DockerImage{
+			Repository: "test",
+			Tag:        "1",
+		})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TEST-0001")
+
+	cfg.VulnerabilitySpec.FailSeverity = "CRITICAL"
+	dockerBuildPath, err := prepare.Prepare(cfg, auroraVersions,
+		nexus.Deliverable{Path: "testdata/minarch-1.2.22-Leveransepakke.zip"},
+		runtime.DockerImage{
+			Repository: "test",
+			Tag:        "1",
+		})
+
+	assert.NoError(t, err)
+	os.RemoveAll(dockerBuildPath)
+}
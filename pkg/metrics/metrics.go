@@ -0,0 +1,297 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/process/progress"
+	"github.com/skatteetaten/architect/pkg/util"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	Job = "architect"
+
+	ContentType = "text/plain; version=0.0.4"
+)
+
+// Run is the outcome of one build or retag. The Pushgateway keeps only the last push of each group, so the
+// metrics are gauges of the last run. Runs over time are counted in Prometheus from the timestamps, which
+// change on every run.
+type Run struct {
+	Operation       string
+	ApplicationType config.ApplicationType
+	// The namespace of the build, or the group id of the application outside OpenShift
+	Group           string
+	Application     string
+	Phases          []progress.Phase
+	Duration        time.Duration
+	DownloadedBytes int64
+	PushedBytes     int64
+	Err             error
+	Time            time.Time
+}
+
+// NewRun creates a run from the phases recorded by the progress
+func NewRun(operation string, cfg *config.Config, p *progress.Progress, err error) *Run {
+	group := cfg.BuildMetadata.Namespace
+	if group == "" {
+		group = cfg.ApplicationSpec.MavenGav.GroupId
+	}
+	return &Run{
+		Operation:       operation,
+		ApplicationType: cfg.ApplicationType,
+		Group:           group,
+		Application:     cfg.ApplicationSpec.MavenGav.ArtifactId,
+		Phases:          p.Phases,
+		Duration:        p.Duration(),
+		Err:             err,
+		Time:            time.Now(),
+	}
+}
+
+// Reason gives a failure a short name suitable as a label value
+func Reason(err error) string {
+	if err == nil {
+		return ""
+	}
+	cause := errors.Cause(err)
+	switch {
+	case cause == context.Canceled:
+		return "cancelled"
+	case cause == context.DeadlineExceeded || strings.Contains(err.Error(), "timed out after"):
+		return "timeout"
+	case docker.IsUnauthorized(err):
+		return "unauthorized"
+	case docker.IsImageNotFound(err):
+		return "image_not_found"
+	case docker.IsBuildStepError(err):
+		return "build_step"
+	case util.IsRetryable(err):
+		return "unavailable"
+	}
+	return "error"
+}
+
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+func (m *Run) labels(extra ...string) map[string]string {
+	l := map[string]string{
+		"operation":        m.Operation,
+		"application_type": string(m.ApplicationType),
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		l[extra[i]] = extra[i+1]
+	}
+	return l
+}
+
+func (m *Run) result() string {
+	if m.Err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+func (m *Run) metrics() []metric {
+	labels := m.labels
+
+	// A phase may run more than once, e.g. build and push of each image
+	phaseDurations := make(map[string]time.Duration)
+	phaseNames := make([]string, 0)
+	failedPhase := ""
+	for _, phase := range m.Phases {
+		if _, ok := phaseDurations[phase.Name]; !ok {
+			phaseNames = append(phaseNames, phase.Name)
+		}
+		phaseDurations[phase.Name] += phase.Duration
+		if phase.Status == progress.Failed {
+			failedPhase = phase.Name
+		}
+	}
+	phases := make([]sample, 0, len(phaseNames))
+	for _, name := range phaseNames {
+		phases = append(phases, sample{labels("phase", name), phaseDurations[name].Seconds()})
+	}
+
+	return []metric{
+		{
+			name:    "architect_build_result",
+			help:    "Result of the last build, with the failure reason and phase for a failed build. Always 1.",
+			kind:    "gauge",
+			samples: []sample{{labels("result", m.result(), "reason", Reason(m.Err), "phase", failedPhase), 1}},
+		},
+		{
+			name:    "architect_build_duration_seconds",
+			help:    "Duration of the build.",
+			kind:    "gauge",
+			samples: []sample{{labels(), m.Duration.Seconds()}},
+		},
+		{
+			name:    "architect_phase_duration_seconds",
+			help:    "Duration of each phase of the build.",
+			kind:    "gauge",
+			samples: phases,
+		},
+		{
+			name:    "architect_downloaded_bytes",
+			help:    "Size of the deliverable downloaded from Nexus.",
+			kind:    "gauge",
+			samples: []sample{{labels(), float64(m.DownloadedBytes)}},
+		},
+		{
+			name:    "architect_pushed_bytes",
+			help:    "Size of the layers pushed to the registry. Layers that already exist are not counted.",
+			kind:    "gauge",
+			samples: []sample{{labels(), float64(m.PushedBytes)}},
+		},
+		{
+			name:    "architect_build_timestamp_seconds",
+			help:    "When the last build finished.",
+			kind:    "gauge",
+			samples: []sample{{labels(), float64(m.Time.Unix())}},
+		},
+	}
+}
+
+// resultMetrics is pushed to a group of its own for each result and reason, so that the last run with each
+// result is kept when a run with another result replaces the metrics of the application
+func (m *Run) resultMetrics() []metric {
+	return []metric{
+		{
+			name:    "architect_build_result_timestamp_seconds",
+			help:    "When the last build with the result and reason of the group finished.",
+			kind:    "gauge",
+			samples: []sample{{m.labels(), float64(m.Time.Unix())}},
+		},
+	}
+}
+
+// Write writes the metrics in the Prometheus text format
+func (m *Run) Write(w io.Writer) error {
+	return write(w, m.metrics())
+}
+
+func write(w io.Writer, metrics []metric) error {
+	buffer := new(bytes.Buffer)
+	for _, metric := range metrics {
+		fmt.Fprintf(buffer, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(buffer, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, sample := range metric.samples {
+			fmt.Fprintf(buffer, "%s{%s} %g\n", metric.name, formatLabels(sample.labels), sample.value)
+		}
+	}
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	replacer := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, replacer.Replace(labels[name])))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Push replaces the metrics of the application in the Pushgateway. The group is the job, operation, namespace
+// and application, so the Pushgateway keeps the last run of each. The result timestamp is pushed to a group
+// that also has the result and reason, so that runs are counted by result and reason over time. The metrics are
+// pushed even if the build was cancelled, so the push has its own timeout.
+func (m *Run) Push(pushgatewayUrl string) error {
+	application := m.Application
+	if application == "" {
+		application = "unknown"
+	}
+	groupingKey := []string{"job", Job, "operation", m.Operation}
+	if m.Group != "" {
+		groupingKey = append(groupingKey, "group", m.Group)
+	}
+	groupingKey = append(groupingKey, "application", application)
+	if err := push(pushgatewayUrl, groupingKey, m.metrics()); err != nil {
+		return err
+	}
+	groupingKey = append(groupingKey, "result", m.result())
+	if m.Err != nil {
+		groupingKey = append(groupingKey, "reason", Reason(m.Err))
+	}
+	return push(pushgatewayUrl, groupingKey, m.resultMetrics())
+}
+
+// push replaces the group given by the label names and values in groupingKey with the metrics
+func push(pushgatewayUrl string, groupingKey []string, metrics []metric) error {
+	buffer := new(bytes.Buffer)
+	if err := write(buffer, metrics); err != nil {
+		return err
+	}
+	target := strings.TrimRight(pushgatewayUrl, "/") + "/metrics"
+	for _, value := range groupingKey {
+		target += "/" + url.PathEscape(value)
+	}
+
+	req, err := http.NewRequest("PUT", target, buffer)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request for %s", target)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to push metrics to %s", target)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("Failed to push metrics to %s. Status %s: %s", target, res.Status, string(body))
+	}
+	return nil
+}
+
+// Export writes and pushes the metrics as configured. Metrics are not allowed to fail the build, so
+// errors are only logged.
+func Export(spec config.MetricsSpec, run *Run) {
+	if spec.File != "" {
+		buffer := new(bytes.Buffer)
+		err := run.Write(buffer)
+		if err == nil {
+			err = ioutil.WriteFile(spec.File, buffer.Bytes(), 0644)
+		}
+		if err != nil {
+			logrus.Warnf("Failed to write metrics to %s: %s", spec.File, err)
+		} else {
+			logrus.Debugf("Wrote metrics to %s", spec.File)
+		}
+	}
+	if spec.PushgatewayUrl != "" {
+		if err := run.Push(spec.PushgatewayUrl); err != nil {
+			logrus.Warnf("%s", err)
+		} else {
+			logrus.Debugf("Pushed metrics to %s", spec.PushgatewayUrl)
+		}
+	}
+}
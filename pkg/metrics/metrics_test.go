@@ -0,0 +1,137 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/metrics"
+	"github.com/skatteetaten/architect/pkg/process/progress"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newRun(err error) *metrics.Run {
+	return &metrics.Run{
+		Operation:       "build",
+		ApplicationType: config.JavaLeveransepakke,
+		Application:     "app",
+		Phases: []progress.Phase{
+			{Name: "download", Duration: 1500 * time.Millisecond, Status: progress.Succeeded},
+			{Name: "push", Duration: 2 * time.Second, Status: progress.Succeeded},
+			{Name: "push", Duration: time.Second, Status: progress.Failed},
+		},
+		Duration:        5 * time.Second,
+		DownloadedBytes: 1024,
+		PushedBytes:     4096,
+		Err:             err,
+		Time:            time.Unix(1500000000, 0),
+	}
+}
+
+func TestWrite(t *testing.T) {
+	run := newRun(errors.Wrap(&docker.UnauthorizedError{Image: "foo/bar", Message: "denied"}, "Error pushing images"))
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, run.Write(buffer))
+	text := buffer.String()
+
+	assert.Contains(t, text, "# TYPE architect_build_result gauge\n")
+	assert.Contains(t, text, `architect_build_result{application_type="JavaLeveransepakke",operation="build",phase="push",reason="unauthorized",result="failure"} 1`)
+	assert.Contains(t, text, `architect_phase_duration_seconds{application_type="JavaLeveransepakke",operation="build",phase="download"} 1.5`)
+	assert.Contains(t, text, `architect_phase_duration_seconds{application_type="JavaLeveransepakke",operation="build",phase="push"} 3`)
+	assert.Contains(t, text, `architect_downloaded_bytes{application_type="JavaLeveransepakke",operation="build"} 1024`)
+	assert.Contains(t, text, `architect_pushed_bytes{application_type="JavaLeveransepakke",operation="build"} 4096`)
+	assert.Contains(t, text, `architect_build_timestamp_seconds{application_type="JavaLeveransepakke",operation="build"} 1.5e+09`)
+}
+
+func TestReason(t *testing.T) {
+	assert.Equal(t, "", metrics.Reason(nil))
+	assert.Equal(t, "cancelled", metrics.Reason(errors.Wrap(context.Canceled, "Push interrupted")))
+	assert.Equal(t, "timeout", metrics.Reason(errors.Wrap(errors.New("read tcp"), "Download timed out after 1m0s")))
+	assert.Equal(t, "image_not_found", metrics.Reason(&docker.ImageNotFoundError{Image: "foo/bar"}))
+	assert.Equal(t, "build_step", metrics.Reason(&docker.BuildStepError{Step: "Step 2 : RUN exit 3"}))
+	assert.Equal(t, "error", metrics.Reason(errors.New("There are already a build with tag 1.2.3")))
+}
+
+type pushed struct {
+	method, path, contentType, body string
+}
+
+func startPushgateway(requests *[]pushed) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := ioutil.ReadAll(r.Body)
+		*requests = append(*requests, pushed{r.Method, r.URL.Path, r.Header.Get("Content-Type"), string(content)})
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+func TestExport(t *testing.T) {
+	requests := make([]pushed, 0)
+	server := startPushgateway(&requests)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "metrics.prom")
+
+	run := newRun(nil)
+	run.Group = "aurora-build"
+	metrics.Export(config.MetricsSpec{PushgatewayUrl: server.URL + "/", File: file}, run)
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "PUT", requests[0].method)
+	assert.Equal(t, "/metrics/job/architect/operation/build/group/aurora-build/application/app", requests[0].path)
+	assert.Equal(t, metrics.ContentType, requests[0].contentType)
+	assert.Contains(t, requests[0].body, `result="success"`)
+
+	assert.Equal(t, "PUT", requests[1].method)
+	assert.Equal(t, "/metrics/job/architect/operation/build/group/aurora-build/application/app/result/success",
+		requests[1].path)
+	assert.Contains(t, requests[1].body,
+		`architect_build_result_timestamp_seconds{application_type="JavaLeveransepakke",operation="build"} 1.5e+09`)
+
+	content, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, requests[0].body, string(content))
+}
+
+func TestPushFailureByReason(t *testing.T) {
+	requests := make([]pushed, 0)
+	server := startPushgateway(&requests)
+	defer server.Close()
+
+	assert.NoError(t, newRun(errors.Wrap(context.DeadlineExceeded, "Push interrupted")).Push(server.URL))
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "/metrics/job/architect/operation/build/application/app", requests[0].path)
+	assert.Equal(t, "/metrics/job/architect/operation/build/application/app/result/failure/reason/timeout",
+		requests[1].path)
+}
+
+func TestNewRunGroup(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.ApplicationSpec.MavenGav.GroupId = "no.skatteetaten.aurora"
+	assert.Equal(t, "no.skatteetaten.aurora", metrics.NewRun("build", cfg, progress.New("Build"), nil).Group)
+
+	cfg.BuildMetadata.Namespace = "aurora-build"
+	assert.Equal(t, "aurora-build", metrics.NewRun("build", cfg, progress.New("Build"), nil).Group)
+}
+
+func TestPushFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := newRun(nil).Push(server.URL)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "400")
+}
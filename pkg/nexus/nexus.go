@@ -1,25 +1,32 @@
 package nexus
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/tracing"
+	"github.com/skatteetaten/architect/pkg/util"
 	"io"
 	"io/ioutil"
 	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Downloader interface {
-	DownloadArtifact(c *config.MavenGav) (Deliverable, error)
+	DownloadArtifact(ctx context.Context, c *config.MavenGav) (Deliverable, error)
 }
 
 type NexusDownloader struct {
 	baseUrl string
+	client  *http.Client
+	retry   util.RetryPolicy
 }
 
 type BinaryDownloader struct {
@@ -30,9 +37,19 @@ type Deliverable struct {
 	Path string
 }
 
-func NewNexusDownloader(baseUrl string) Downloader {
+func NewNexusDownloader(baseUrl string, retry util.RetryPolicy) Downloader {
+	// No overall timeout, as the download is cancelled through its context
+	tr := &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		ResponseHeaderTimeout: 60 * time.Second,
+	}
 	return &NexusDownloader{
 		baseUrl: baseUrl,
+		client:  &http.Client{Transport: tracing.NewTransport(tr)},
+		retry:   retry,
 	}
 }
 
@@ -42,7 +59,7 @@ func NewBinaryDownloader(path string) Downloader {
 	}
 }
 
-func (n *BinaryDownloader) DownloadArtifact(c *config.MavenGav) (Deliverable, error) {
+func (n *BinaryDownloader) DownloadArtifact(ctx context.Context, c *config.MavenGav) (Deliverable, error) {
 	deliverable := Deliverable{
 		Path: n.Path,
 	}
@@ -52,19 +69,36 @@ func (n *BinaryDownloader) DownloadArtifact(c *config.MavenGav) (Deliverable, er
 	return deliverable, nil
 }
 
-func (n *NexusDownloader) DownloadArtifact(c *config.MavenGav) (Deliverable, error) {
+func (n *NexusDownloader) DownloadArtifact(ctx context.Context, c *config.MavenGav) (Deliverable, error) {
 	resourceUrl, err := n.createURL(c)
 	deliverable := Deliverable{}
 	if err != nil {
 		return deliverable, errors.Wrapf(err, "Failed to create Nexus url for GAV %+v", c)
 	}
 
-	httpResponse, err := http.Get(resourceUrl)
+	err = n.retry.Do(ctx, "Download of "+resourceUrl, func() error {
+		var err error
+		deliverable, err = n.download(ctx, resourceUrl)
+		return err
+	})
+	return deliverable, err
+}
+
+func (n *NexusDownloader) download(ctx context.Context, resourceUrl string) (Deliverable, error) {
+	deliverable := Deliverable{}
+	req, err := http.NewRequest("GET", resourceUrl, nil)
+	if err != nil {
+		return deliverable, errors.Wrapf(err, "Failed to create request for %s", resourceUrl)
+	}
+	httpResponse, err := n.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return deliverable, errors.Wrapf(err, "Failed to get artifact from Nexus %s", resourceUrl)
 	}
 	defer httpResponse.Body.Close()
 
+	if statusError := util.NewStatusError(httpResponse); statusError.Temporary() {
+		return deliverable, errors.Wrap(statusError, "Nexus is not available")
+	}
 	if httpResponse.StatusCode != http.StatusOK {
 		return deliverable, errors.Errorf("Could not download artifact (Make sure you have deployed it!)"+
 			". Status code %s ", httpResponse.Status)
@@ -94,6 +128,8 @@ func (n *NexusDownloader) DownloadArtifact(c *config.MavenGav) (Deliverable, err
 
 	_, err = io.Copy(fileCreated, httpResponse.Body)
 	if err != nil {
+		// Do not leave a partial artifact behind if the download is retried
+		os.RemoveAll(dir)
 		return deliverable, errors.Wrap(err, "Failed to write to artifact file")
 	}
 	deliverable.Path = fileName
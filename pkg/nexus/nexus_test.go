@@ -3,13 +3,16 @@ package nexus
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/util"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDownloadFromNexusServer(t *testing.T) {
@@ -27,14 +30,14 @@ func TestDownloadFromNexusServer(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	n := NewNexusDownloader(ts.URL)
+	n := NewNexusDownloader(ts.URL, util.RetryPolicy{})
 	m := config.MavenGav{
 		ArtifactId: "openshift-resource-monitor",
 		GroupId:    "ske.fellesplattform.monitor",
 		Version:    "1.1.4",
 	}
 
-	r, err := n.DownloadArtifact(&m)
+	r, err := n.DownloadArtifact(context.Background(), &m)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -46,6 +49,78 @@ func TestDownloadFromNexusServer(t *testing.T) {
 	}
 }
 
+func TestDownloadRetriesWhenNexusIsUnavailable(t *testing.T) {
+	b, err := createZipFile()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	zipFileName := "my-test-package-1.0.0-Leveransepakke.zip"
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if requests == 2 {
+			// Promise more than we send, so that the client gets an unexpected EOF
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b.Bytes())+100))
+			w.Header().Set("Content-Disposition", "attachment; filename=\""+zipFileName+"\"")
+			w.Write(b.Bytes())
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b.Bytes())))
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+zipFileName+"\"")
+		w.Write(b.Bytes())
+	}))
+	defer ts.Close()
+
+	n := NewNexusDownloader(ts.URL, util.RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond})
+	m := config.MavenGav{
+		ArtifactId: "openshift-resource-monitor",
+		GroupId:    "ske.fellesplattform.monitor",
+		Version:    "1.1.4",
+	}
+
+	r, err := n.DownloadArtifact(context.Background(), &m)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, was %d", requests)
+	}
+	if strings.Contains(r.Path, zipFileName) == false {
+		t.Error(
+			"excpected", zipFileName,
+			"got", r)
+	}
+}
+
+func TestDownloadDoesNotRetryMissingArtifact(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	n := NewNexusDownloader(ts.URL, util.RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond})
+	m := config.MavenGav{
+		ArtifactId: "dontexist",
+		GroupId:    "ske",
+		Version:    "1.0.0",
+	}
+
+	_, err := n.DownloadArtifact(context.Background(), &m)
+	if err == nil {
+		t.Error("Error expected on missing artifact")
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 request, was %d", requests)
+	}
+}
+
 func TestNewLocalDownloader(t *testing.T) {
 	d := NewBinaryDownloader("test")
 	m := config.MavenGav{
@@ -53,7 +128,7 @@ func TestNewLocalDownloader(t *testing.T) {
 		GroupId:    "ske",
 		Version:    "develop-SNAPSHOT",
 	}
-	l, err := d.DownloadArtifact(&m)
+	l, err := d.DownloadArtifact(context.Background(), &m)
 
 	expected := "test"
 	if l.Path != expected {
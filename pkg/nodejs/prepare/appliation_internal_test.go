@@ -12,7 +12,7 @@ import (
 const buildTime = "2016-09-12T14:30:10Z"
 const expectedNodeJsDockerFile = `FROM aurora/wrench:latest
 
-LABEL maintainer="Oyvind <oyvind@dagobah.wars>" version="1.2.3"
+LABEL maintainer="Oyvind <oyvind@dagobah.wars>" org.opencontainers.image.created="2016-09-12T14:30:10Z" version="1.2.3"
 
 COPY ./architectscripts /u01/architect
 
@@ -87,7 +87,7 @@ func TestNodeJsDockerFiles(t *testing.T) {
 	err := prepareImage(&testVersion, runtime.DockerImage{
 		Tag:        "latest",
 		Repository: "aurora/wrench",
-	}, "1.2.3", testFileWriter(files), buildTime)
+	}, "1.2.3", map[string]string{"org.opencontainers.image.created": buildTime}, testFileWriter(files), buildTime)
 	assert.NoError(t, err)
 	assert.Equal(t, files["Dockerfile"], expectedNodeJsDockerFile)
 	assert.Equal(t, files["nginx.conf"], expectedNginxConfFile)
@@ -9,7 +9,11 @@ import (
 	"github.com/skatteetaten/architect/pkg/java/prepare/resources"
 	"github.com/skatteetaten/architect/pkg/nexus"
 	"github.com/skatteetaten/architect/pkg/process/build"
+	"github.com/skatteetaten/architect/pkg/sbom"
 	"github.com/skatteetaten/architect/pkg/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 type AuroraApplication struct {
@@ -107,7 +111,7 @@ func Prepper() process.Prepper {
 	return func(cfg *config.Config, auroraVersion *runtime.AuroraVersion, deliverable nexus.Deliverable,
 		baseImage runtime.DockerImage) ([]docker.DockerBuildConfig, error) {
 
-		preparedImages, err := prepare(cfg.ApplicationSpec, auroraVersion, deliverable, baseImage)
+		preparedImages, err := prepare(cfg, auroraVersion, deliverable, baseImage)
 		if err != nil {
 			return nil, err
 		}
@@ -125,9 +129,9 @@ func Prepper() process.Prepper {
 	}
 }
 
-func prepare(c config.ApplicationSpec, auroraVersion *runtime.AuroraVersion,
+func prepare(cfg *config.Config, auroraVersion *runtime.AuroraVersion,
 	deliverable nexus.Deliverable, baseImage runtime.DockerImage) ([]PreparedImage, error) {
-	logrus.Debug("Building %s", c.MavenGav.Name())
+	logrus.Debugf("Building %s", cfg.ApplicationSpec.MavenGav.Name())
 
 	openshiftJson, err := findOpenshiftJsonInTarball(deliverable.Path)
 	if err != nil {
@@ -140,7 +144,17 @@ func prepare(c config.ApplicationSpec, auroraVersion *runtime.AuroraVersion,
 	}
 
 	imageBuildTime := docker.GetUtcTimestamp()
-	err = prepareImage(openshiftJson, baseImage, string(auroraVersion.GetAppVersion()), util.NewFileWriter(pathToApplication), imageBuildTime)
+	fileWriter := util.NewFileWriter(pathToApplication)
+
+	err = addBillOfMaterials(fileWriter, pathToApplication, cfg, auroraVersion, imageBuildTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create software bill of materials")
+	}
+
+	provenanceLabels := docker.CreateProvenanceLabels(cfg, auroraVersion, baseImage, imageBuildTime)
+	provenanceLabels[docker.LABEL_SBOM] = sbom.ImagePath
+	err = prepareImage(openshiftJson, baseImage, string(auroraVersion.GetAppVersion()), provenanceLabels,
+		fileWriter, imageBuildTime)
 	if err != nil {
 		return nil, err
 	}
@@ -151,8 +165,33 @@ func prepare(c config.ApplicationSpec, auroraVersion *runtime.AuroraVersion,
 	}}, nil
 }
 
-func prepareImage(v *OpenshiftJson, baseImage runtime.DockerImage, version string, writer util.FileWriter,
-	imageBuildTime string) error {
+// The bill of materials is read from package-lock.json if present, otherwise from the installed node_modules.
+// It is written to architectscripts, which is copied to /u01/architect in the image
+func addBillOfMaterials(fileWriter util.FileWriter, pathToApplication string, cfg *config.Config,
+	auroraVersion *runtime.AuroraVersion, imageBuildTime string) error {
+	packageDirectory := filepath.Join(pathToApplication, "package")
+	var components []sbom.Component
+	lockfile, err := ioutil.ReadFile(filepath.Join(packageDirectory, "package-lock.json"))
+	if err == nil {
+		components, err = sbom.FromPackageLock(lockfile)
+	} else if os.IsNotExist(err) {
+		logrus.Debug("No package-lock.json in deliverable, reading node_modules")
+		components, err = sbom.FromNodeModules(filepath.Join(packageDirectory, "node_modules"))
+		if os.IsNotExist(errors.Cause(err)) {
+			components, err = []sbom.Component{}, nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	application := sbom.NewApplicationComponent(cfg.ApplicationSpec.MavenGav, string(auroraVersion.GetAppVersion()))
+	bom := sbom.NewBom(application, components, imageBuildTime)
+	return fileWriter(sbom.NewBomWriter(bom), "architectscripts", "sbom.json")
+}
+
+func prepareImage(v *OpenshiftJson, baseImage runtime.DockerImage, version string, provenanceLabels map[string]string,
+	writer util.FileWriter, imageBuildTime string) error {
 	labels := make(map[string]string)
 	if v.DockerMetadata.Labels != nil {
 		for k, v := range v.DockerMetadata.Labels {
@@ -161,6 +200,9 @@ func prepareImage(v *OpenshiftJson, baseImage runtime.DockerImage, version strin
 	}
 	labels["version"] = version
 	labels["maintainer"] = findMaintainer(v.DockerMetadata)
+	for k, v := range provenanceLabels {
+		labels[k] = v
+	}
 
 	input := &struct {
 		Baseimage        string
@@ -1,6 +1,7 @@
 package prepare_test
 
 import (
+	"context"
 	"github.com/skatteetaten/architect/pkg/config"
 	"github.com/skatteetaten/architect/pkg/config/runtime"
 	"github.com/skatteetaten/architect/pkg/docker"
@@ -8,6 +9,7 @@ import (
 	"github.com/skatteetaten/architect/pkg/nodejs/prepare"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -39,25 +41,32 @@ func TestApplicationPrepare(t *testing.T) {
 	b := bc[0]
 	assert.Equal(t, "0.1.2-b--baseimageversion", b.AuroraVersion.GetCompleteVersion())
 	assert.Equal(t, "0.1.2", string(b.AuroraVersion.GetAppVersion()))
-	repositoryTags, _ := imageInfoProvider.GetTags("test")
-	tags, err := b.AuroraVersion.GetApplicationVersionTagsToPush(repositoryTags.Tags, config.ParseExtraTags("latest major minor patch"))
+	repositoryTags, _ := imageInfoProvider.GetTags(context.Background(), "test")
+	extraTags, err := config.ParseExtraTags("latest major minor patch")
+	assert.NoError(t, err)
+	tags, err := b.AuroraVersion.GetApplicationVersionTagsToPush(repositoryTags.Tags, extraTags)
 	assert.NoError(t, err)
 	assert.Equal(t, []string{"0.1", "0.1.2", "0.1.2-b--baseimageversion"}, tags)
+	_, err = os.Stat(filepath.Join(b.BuildFolder, "architectscripts", "sbom.json"))
+	assert.NoError(t, err)
 	os.RemoveAll(b.BuildFolder)
 }
 
 type testImageInfoProvider struct {
 }
 
-func (m *testImageInfoProvider) GetCompleteBaseImageVersion(repository string, tag string) (string, error) {
+func (m *testImageInfoProvider) GetCompleteBaseImageVersion(ctx context.Context, repository string, tag string) (string, error) {
 	return "baseimageversion", nil
 }
-func (m *testImageInfoProvider) GetTags(repository string) (*docker.TagsAPIResponse, error) {
+func (m *testImageInfoProvider) GetTags(ctx context.Context, repository string) (*docker.TagsAPIResponse, error) {
 	return &docker.TagsAPIResponse{
 		Name: repository,
 		Tags: []string{"0", "0.2.0", "0.1.1"},
 	}, nil
 }
-func (m *testImageInfoProvider) GetManifestEnvMap(repository string, tag string) (map[string]string, error) {
+func (m *testImageInfoProvider) GetManifestEnvMap(ctx context.Context, repository string, tag string) (map[string]string, error) {
 	return nil, nil
 }
+func (m *testImageInfoProvider) GetImageDigest(ctx context.Context, repository string, tag string) (string, error) {
+	return "", nil
+}
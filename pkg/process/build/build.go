@@ -1,116 +1,419 @@
 package process
 
 import (
+	"context"
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 	"github.com/skatteetaten/architect/pkg/config"
 	"github.com/skatteetaten/architect/pkg/config/runtime"
 	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/metrics"
 	"github.com/skatteetaten/architect/pkg/nexus"
+	"github.com/skatteetaten/architect/pkg/process/progress"
 	"github.com/skatteetaten/architect/pkg/process/tagger"
+	"github.com/skatteetaten/architect/pkg/signing"
+	"github.com/skatteetaten/architect/pkg/tracing"
+	"github.com/skatteetaten/architect/pkg/util"
+	"os"
+	"strings"
+	"time"
 )
 
 //TODO: Write some test for this..
 // Need to initialize RegistryClient and DockerClient outside of this function
-func Build(credentials *docker.RegistryCredentials, cfg *config.Config, downloader nexus.Downloader, prepper Prepper) error {
-	provider := docker.NewRegistryClient(cfg.DockerSpec.ExternalDockerRegistry)
+// The build is stopped when ctx is cancelled, and each phase is limited by the timeouts in the config.
+// Credentials are resolved for the registry of each operation, so the base image may be in another registry
+// than the output image.
+func Build(ctx context.Context, credentials docker.RegistryCredentialsFunc, cfg *config.Config, downloader nexus.Downloader, prepper Prepper) (err error) {
+	phases := progress.New("Build")
+	tracer := tracing.NewTracer(cfg)
+	ctx, span := tracing.StartSpan(tracing.WithTracer(ctx, tracer), "build", tracing.KindInternal)
+	var client *docker.DockerClient
+	var deliverable nexus.Deliverable
+	defer func() {
+		phases.Summary(err)
+		exportMetrics(cfg, phases, deliverable, client, err)
+		span.Finish(err)
+		tracer.Export(cfg.TracingSpec)
+	}()
+	retry := cfg.RetrySpec.RetryPolicy()
+	externalCredentials, err := credentials(cfg.DockerSpec.ExternalDockerRegistry)
+	if err != nil {
+		return errors.Wrap(err, "Error reading credentials for the external registry")
+	}
+	outputCredentials, err := credentials(cfg.DockerSpec.OutputRegistry)
+	if err != nil {
+		return errors.Wrap(err, "Error reading credentials for the output registry")
+	}
+	provider := docker.NewRegistryClient(cfg.DockerSpec.ExternalDockerRegistry, retry, externalCredentials)
+	timeouts := cfg.TimeoutSpec
 
-	logrus.Debugf("Download deliverable for GAV %-v", cfg.ApplicationSpec)
-	deliverable, err := downloader.DownloadArtifact(&cfg.ApplicationSpec.MavenGav)
+	err = phases.Run(ctx, "download", func(ctx context.Context) error {
+		logrus.Debugf("Download deliverable for GAV %-v", cfg.ApplicationSpec)
+		downloadCtx, cancelDownload := util.WithTimeout(ctx, timeouts.Download)
+		defer cancelDownload()
+		var err error
+		deliverable, err = downloader.DownloadArtifact(downloadCtx, &cfg.ApplicationSpec.MavenGav)
+		return phaseError(downloadCtx, err, "Download", timeouts.Download)
+	})
 	if err != nil {
 		return errors.Wrapf(err, "Could not download deliverable %-v", cfg.ApplicationSpec)
 	}
 	application := cfg.ApplicationSpec
-	logrus.Debug("Extract build info")
 
-	completeBaseImageVersion, err := provider.GetCompleteBaseImageVersion(application.BaseImageSpec.BaseImage,
-		application.BaseImageSpec.BaseVersion)
+	var auroraVersion *runtime.AuroraVersion
+	var baseImage runtime.DockerImage
+	var platformBaseImages []platformImage
+	err = phases.Run(ctx, "resolve base", func(ctx context.Context) error {
+		logrus.Debug("Extract build info")
+		baseRegistry, baseCredentials, err := selectBaseRegistry(ctx, cfg, credentials)
+		if err != nil {
+			return err
+		}
+		baseProvider := provider
+		if baseRegistry != cfg.DockerSpec.ExternalDockerRegistry {
+			baseProvider = docker.NewRegistryClient(baseRegistry, retry, baseCredentials)
+		}
+
+		baseVersion, err := resolveBaseVersion(ctx, baseProvider, application.BaseImageSpec)
+		if err != nil {
+			return err
+		}
+		completeBaseImageVersion, err := baseProvider.GetCompleteBaseImageVersion(ctx, application.BaseImageSpec.BaseImage,
+			baseVersion)
+		if err != nil {
+			return errors.Wrap(err, "Unable to get the complete build version")
+		}
+
+		// The base image is pinned by digest, so that the tag can not be moved during the build
+		digest := baseVersion
+		if !docker.IsDigest(baseVersion) {
+			digest, err = baseProvider.GetImageDigest(ctx, application.BaseImageSpec.BaseImage, completeBaseImageVersion)
+			if err != nil {
+				return errors.Wrapf(err, "Unable to get the digest of base image %s:%s",
+					application.BaseImageSpec.BaseImage, completeBaseImageVersion)
+			}
+		}
+
+		baseImage = runtime.DockerImage{
+			Tag:        completeBaseImageVersion,
+			Repository: application.BaseImageSpec.BaseImage,
+			Registry:   strings.TrimPrefix(baseRegistry, "https://"),
+			Digest:     digest,
+		}
+		logrus.Infof("Using base image %s", baseImage.GetCompleteDockerTagName())
+		imageConfig, err := getBaseImageConfig(ctx, baseRegistry, baseCredentials, baseImage)
+		if err != nil {
+			return err
+		}
+		err = docker.NewBaseImageContract(cfg.ApplicationType).Verify(baseImage.GetCompleteDockerTagName(), imageConfig)
+		if err != nil {
+			return err
+		}
+		baseImage.Deprecated, err = docker.CheckBaseImagePolicy(application.BaseImageSpec.Policy, baseImage,
+			imageConfig, time.Now())
+		if err != nil {
+			return err
+		}
+		platformBaseImages, err = findPlatformBaseImages(ctx, cfg, baseRegistry, baseCredentials, baseImage)
+		if err != nil {
+			return err
+		}
+
+		buildImage := &runtime.ArchitectImage{
+			Tag: cfg.BuilderSpec.Version,
+		}
+		appVersion, snapshot, err := findAppVersion(cfg, deliverable)
+		if err != nil {
+			return err
+		}
+		auroraVersion = runtime.NewAuroraVersionFromBuilderAndBase(appVersion, snapshot,
+			application.MavenGav.Version, buildImage, baseImage)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	phases.Set("base_image", baseImage.GetCompleteDockerTagName())
+	phases.Set("base_registry", baseImage.Registry)
+	if baseImage.Deprecated != "" {
+		phases.Set("base_image_deprecated", baseImage.Deprecated)
+	}
+	phases.Set("version", auroraVersion.GetCompleteVersion())
+
+	var dockerBuildConfig []docker.DockerBuildConfig
+	err = phases.Run(ctx, "prepare", func(ctx context.Context) error {
+		var err error
+		if platformBaseImages == nil {
+			dockerBuildConfig, err = prepper(cfg, auroraVersion, deliverable, baseImage)
+		} else {
+			dockerBuildConfig, err = preparePlatforms(cfg, prepper, auroraVersion, deliverable, platformBaseImages)
+		}
+		if err != nil {
+			return errors.Wrap(err, "Error preparing image")
+		}
+		return checkTagOverwrite(ctx, cfg, provider, dockerBuildConfig)
+	})
+	defer removeBuildFolders(dockerBuildConfig)
 	if err != nil {
-		return errors.Wrap(err, "Unable to get the complete build version")
+		return err
 	}
 
-	baseImage := runtime.DockerImage{
-		Tag:        completeBaseImageVersion,
-		Repository: application.BaseImageSpec.BaseImage,
-		Registry:   cfg.DockerSpec.GetExternalRegistryWithoutProtocol(),
+	client, err = docker.NewDockerClient(retry, cfg.Concurrency)
+	if err != nil {
+		return errors.Wrap(err, "Error initializing Docker")
+	}
+	if platformBaseImages != nil {
+		err = phases.Run(ctx, "check platforms", func(ctx context.Context) error {
+			checkCtx, cancelCheck := util.WithTimeout(ctx, timeouts.Build)
+			defer cancelCheck()
+			return phaseError(checkCtx, checkPlatforms(checkCtx, client, credentials, platformBaseImages),
+				"Platform check", timeouts.Build)
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	buildImage := &runtime.ArchitectImage{
-		Tag: cfg.BuilderSpec.Version,
+	signer, err := signing.NewSigner(cfg, outputCredentials)
+	if err != nil {
+		return errors.Wrap(err, "Error initializing image signing")
 	}
-	snapshot := application.MavenGav.IsSnapshot()
-	appVersion := nexus.GetSnapshotTimestampVersion(application.MavenGav, deliverable)
-	auroraVersion := runtime.NewAuroraVersionFromBuilderAndBase(appVersion, snapshot,
-		application.MavenGav.Version, buildImage, baseImage)
+	targets, err := newOutputTargets(cfg, credentials, retry, provider, outputCredentials, signer)
 	if err != nil {
-		return errors.Wrap(err, "Error creating version information")
+		return err
+	}
+	if len(targets) > 1 {
+		defer func() {
+			phases.Set("targets", targetStatus(targets))
+		}()
 	}
 
-	dockerBuildConfig, err := prepper(cfg, auroraVersion, deliverable, baseImage)
+	// The images of a Node.js build, and of each platform, are independent, so they are built concurrently
+	imageids := make([]string, len(dockerBuildConfig))
+	err = util.RunConcurrently(ctx, len(dockerBuildConfig), cfg.Concurrency, func(ctx context.Context, i int) error {
+		var err error
+		imageids[i], err = buildImage(ctx, client, cfg, credentials, phases, dockerBuildConfig[i])
+		return err
+	})
 	if err != nil {
-		return errors.Wrap(err, "Error preparing image")
+		return err
 	}
 
-	if !cfg.DockerSpec.TagOverwrite {
-		for _, buildConfig := range dockerBuildConfig {
-			if !buildConfig.AuroraVersion.Snapshot {
-				tags, err := provider.GetTags(cfg.DockerSpec.OutputRepository)
-				if err != nil {
-					return err
-				}
-				completeVersion := buildConfig.AuroraVersion.GetCompleteVersion()
-				for _, tag := range tags.Tags {
-					if tag == completeVersion {
-						return errors.Errorf("There are already a build with tag %s, consider TAG_OVERWRITE", completeVersion)
-					}
-				}
-			}
+	// Each target gets all images before the next target is pushed to, so that in atomic mode the output
+	// registry, which is last, is only pushed to when every other target has every image
+	pushed, err := forEachTarget(targets, func(target *outputTarget) ([]string, error) {
+		return target.pushImages(ctx, client, phases, dockerBuildConfig, imageids, platformBaseImages != nil)
+	})
+	phases.Set("tags", pushed)
+	return err
+}
+
+// buildImage pulls the base image and builds the image
+func buildImage(ctx context.Context, client *docker.DockerClient, cfg *config.Config,
+	credentials docker.RegistryCredentialsFunc, phases *progress.Progress,
+	buildConfig docker.DockerBuildConfig) (string, error) {
+	timeouts := cfg.TimeoutSpec
+	var imageid string
+	err := phases.Run(ctx, "build", func(ctx context.Context) error {
+		buildCtx, cancelBuild := util.WithTimeout(ctx, timeouts.Build)
+		defer cancelBuild()
+		var err error
+		imageid, err = pullAndBuild(buildCtx, client, credentials, buildConfig)
+		return phaseError(buildCtx, err, "Build", timeouts.Build)
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Fuckup!")
+	} else {
+		logrus.Infof("Done building. Imageid: %s", imageid)
+	}
+	return imageid, nil
+}
+
+func exportMetrics(cfg *config.Config, phases *progress.Progress, deliverable nexus.Deliverable,
+	client *docker.DockerClient, err error) {
+	run := metrics.NewRun("build", cfg, phases, err)
+	if deliverable.Path != "" {
+		if info, err := os.Stat(deliverable.Path); err == nil {
+			run.DownloadedBytes = info.Size()
 		}
 	}
+	if client != nil {
+		run.PushedBytes = client.PushedBytes()
+	}
+	metrics.Export(cfg.MetricsSpec, run)
+}
+
+// resolveBaseVersion finds the highest tag of the base image that satisfies the version constraint of the build.
+// Tags and digests are used as they are.
+func resolveBaseVersion(ctx context.Context, provider docker.ImageInfoProvider, spec config.DockerBaseImageSpec) (string, error) {
+	if !spec.IsVersionConstraint() {
+		return spec.BaseVersion, nil
+	}
+	tags, err := provider.GetTags(ctx, spec.BaseImage)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to get the tags of base image %s", spec.BaseImage)
+	}
+	version, err := runtime.FindHighestVersion(spec.BaseVersion, tags.Tags)
+	if err != nil {
+		return "", err
+	}
+	if version == "" {
+		return "", errors.Errorf("No tag of base image %s satisfies the version constraint %s", spec.BaseImage,
+			spec.BaseVersion)
+	}
+	logrus.WithFields(logrus.Fields{
+		"constraint": spec.BaseVersion,
+		"version":    version,
+	}).Infof("Resolved base image version %s to %s of %d tags in %s", spec.BaseVersion, version, len(tags.Tags),
+		spec.BaseImage)
+	return version, nil
+}
 
-	client, err := docker.NewDockerClient()
+// getBaseImageConfig reads the config of the base image from the registry, so that the base image can be checked
+// against the contract of the application type and the base image policy before the image is built
+func getBaseImageConfig(ctx context.Context, baseRegistry string, credentials *docker.RegistryCredentials,
+	baseImage runtime.DockerImage) (*docker.ImageConfig, error) {
+	reference := baseImage.Tag
+	if baseImage.Digest != "" {
+		reference = baseImage.Digest
+	}
+	registry := docker.NewRegistryApi(baseRegistry, credentials)
+	imageConfig, err := registry.GetImageConfig(ctx, baseImage.Repository, reference)
 	if err != nil {
-		return errors.Wrap(err, "Error initializing Docker")
+		return nil, errors.Wrapf(err, "Unable to get the config of base image %s", baseImage.GetCompleteDockerTagName())
 	}
+	return imageConfig, nil
+}
 
+// Releases can not be built again with the same version, unless TAG_OVERWRITE is set
+func checkTagOverwrite(ctx context.Context, cfg *config.Config, provider docker.ImageInfoProvider, dockerBuildConfig []docker.DockerBuildConfig) error {
+	if cfg.DockerSpec.TagOverwrite {
+		return nil
+	}
 	for _, buildConfig := range dockerBuildConfig {
-		client.PullImage(buildConfig.Baseimage)
-		imageid, err := client.BuildImage(buildConfig.BuildFolder)
+		if !buildConfig.AuroraVersion.Snapshot {
+			tags, err := provider.GetTags(ctx, cfg.DockerSpec.OutputRepository)
+			if err != nil {
+				return err
+			}
+			completeVersion := buildConfig.AuroraVersion.GetCompleteVersion()
+			for _, tag := range tags.Tags {
+				if tag == completeVersion {
+					return errors.Errorf("There are already a build with tag %s, consider TAG_OVERWRITE", completeVersion)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// The base image is pulled by the digest resolved from the registry, so that the build uses the image it resolved
+func pullAndBuild(ctx context.Context, client *docker.DockerClient, credentials docker.RegistryCredentialsFunc,
+	buildConfig docker.DockerBuildConfig) (string, error) {
+	baseCredentials, err := credentials(buildConfig.Baseimage.Registry)
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading credentials for the base image registry")
+	}
+	if err := client.PullImage(ctx, buildConfig.Baseimage, baseCredentials); err != nil {
+		return "", errors.Wrapf(err, "Failed to pull base image %s", buildConfig.Baseimage.GetCompleteDockerTagName())
+	}
+	return client.BuildImage(ctx, buildConfig.BuildFolder)
+}
 
+func tagImage(ctx context.Context, client *docker.DockerClient, cfg *config.Config, provider docker.ImageInfoProvider,
+	buildConfig docker.DockerBuildConfig, imageid string) ([]string, error) {
+	tags, err := resolveTags(ctx, cfg, provider, buildConfig)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Tag image %s with %s", imageid, tags)
+	for _, tag := range tags {
+		err = client.TagImage(ctx, imageid, tag)
 		if err != nil {
-			return errors.Wrap(err, "Fuckup!")
-		} else {
-			logrus.Infof("Done building. Imageid: %s", imageid)
+			return nil, err
 		}
+	}
+	return tags, nil
+}
 
-		var tagResolver tagger.TagResolver
-		if cfg.DockerSpec.TagWith == "" {
-			tagResolver = &tagger.NormalTagResolver{
-				Overwrite:  cfg.DockerSpec.TagOverwrite,
-				Provider:   provider,
-				Registry:   cfg.DockerSpec.OutputRegistry,
-				Repository: buildConfig.DockerRepository,
-			}
-		} else {
-			tagResolver = &tagger.SingleTagTagResolver{
-				Tag:        cfg.DockerSpec.TagWith,
-				Registry:   cfg.DockerSpec.OutputRegistry,
-				Repository: buildConfig.DockerRepository,
-			}
+func resolveTags(ctx context.Context, cfg *config.Config, provider docker.ImageInfoProvider,
+	buildConfig docker.DockerBuildConfig) ([]string, error) {
+	var tagResolver tagger.TagResolver
+	if cfg.DockerSpec.TagWith == "" && cfg.DockerSpec.TagPolicy != nil {
+		tagResolver = &tagger.PolicyTagResolver{
+			Overwrite:  cfg.DockerSpec.TagOverwrite,
+			Provider:   provider,
+			Registry:   cfg.DockerSpec.OutputRegistry,
+			Repository: buildConfig.DockerRepository,
+			Policy:     cfg.DockerSpec.TagPolicy,
+			Source:     cfg.SourceSpec,
 		}
+	} else if cfg.DockerSpec.TagWith == "" {
+		tagResolver = &tagger.NormalTagResolver{
+			Overwrite:  cfg.DockerSpec.TagOverwrite,
+			Provider:   provider,
+			Registry:   cfg.DockerSpec.OutputRegistry,
+			Repository: buildConfig.DockerRepository,
+		}
+	} else {
+		tagResolver = &tagger.SingleTagTagResolver{
+			Tag:        cfg.DockerSpec.TagWith,
+			Registry:   cfg.DockerSpec.OutputRegistry,
+			Repository: buildConfig.DockerRepository,
+		}
+	}
 
-		tags, err := tagResolver.ResolveTags(buildConfig.AuroraVersion, cfg.DockerSpec.PushExtraTags)
-		logrus.Debugf("Tag image %s with %s", imageid, tags)
-		for _, tag := range tags {
-			err = client.TagImage(imageid, tag)
-			if err != nil {
-				return err
-			}
+	tags, err := tagResolver.ResolveTags(ctx, buildConfig.AuroraVersion, cfg.DockerSpec.PushExtraTags)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error resolving tags")
+	}
+	return tags, nil
+}
+
+func push(ctx context.Context, client *docker.DockerClient, signer *signing.Signer, credentials *docker.RegistryCredentials,
+	tags []string) error {
+	err := client.PushImages(ctx, tags, credentials)
+	if err != nil {
+		return errors.Wrap(err, "Error pushing images")
+	}
+	// All tags point to the same manifest, so it is enough to sign one of them
+	if signer != nil && len(tags) > 0 {
+		if err := signer.SignImageName(ctx, tags[0]); err != nil {
+			return errors.Wrap(err, "Error signing image")
+		}
+	}
+	return nil
+}
+
+// phaseError tells that a phase was stopped by its timeout, as the error itself only says that the context is done
+func phaseError(ctx context.Context, err error, phase string, timeout time.Duration) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(err, "%s timed out after %s", phase, timeout)
+	}
+	return err
+}
+
+func removeBuildFolders(buildConfigs []docker.DockerBuildConfig) {
+	for _, buildConfig := range buildConfigs {
+		logrus.Debugf("Removing build folder %s", buildConfig.BuildFolder)
+		if err := os.RemoveAll(buildConfig.BuildFolder); err != nil {
+			logrus.Warnf("Failed to remove build folder %s: %s", buildConfig.BuildFolder, err)
 		}
-		err = client.PushImages(tags, credentials)
+	}
+}
+
+// The application version is derived from git when VERSION_SOURCE is git. Otherwise it is the version
+// of the Maven GAV, where snapshots get the timestamp of the downloaded deliverable
+func findAppVersion(cfg *config.Config, deliverable nexus.Deliverable) (string, bool, error) {
+	if cfg.ApplicationSpec.VersionSource == config.GitVersionSource {
+		gitVersion, err := config.NewGitVersion(cfg.SourceSpec)
 		if err != nil {
-			return errors.Wrap(err, "Error pushing images")
+			return "", false, errors.Wrap(err, "Error creating version from git")
 		}
+		logrus.Infof("Using version %s from git", gitVersion.AppVersion)
+		return gitVersion.AppVersion, gitVersion.Snapshot, nil
 	}
-	return nil
+	mavenGav := cfg.ApplicationSpec.MavenGav
+	return nexus.GetSnapshotTimestampVersion(mavenGav, deliverable), mavenGav.IsSnapshot(), nil
 }
@@ -0,0 +1,75 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/nexus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// startBaseImageRegistry serves a base image by the digest of its manifest
+func startBaseImageRegistry(repository string) (*httptest.Server, string) {
+	config := []byte(`{"config": {"Env": ["BASE_IMAGE_VERSION=1.7.0", "HOME=/u01", "TRUST_STORE=/u01/truststore"]}}`)
+	configDigest := docker.Digest(config)
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion": 2, "mediaType": "%s", "config": {"digest": "%s", "size": %d}}`,
+		docker.MediaTypeManifestV2, configDigest, len(config)))
+	manifestDigest := docker.Digest(manifest)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/" + repository + "/manifests/" + manifestDigest:
+			w.Header().Set("Content-Type", docker.MediaTypeManifestV2)
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			w.Write(manifest)
+		case "/v2/" + repository + "/blobs/" + configDigest:
+			w.Write(config)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, manifestDigest
+}
+
+func TestBuildWithGitVersion(t *testing.T) {
+	registry, baseDigest := startBaseImageRegistry("aurora/oracle8")
+	defer registry.Close()
+	deliverable, err := ioutil.TempFile("", "leveransepakke")
+	assert.NoError(t, err)
+	deliverable.Close()
+	defer os.Remove(deliverable.Name())
+
+	cfg, err := config.NewFileConfigReader("../../../testdata/build-git.json").ReadConfig()
+	assert.NoError(t, err)
+	cfg.DockerSpec.ExternalDockerRegistry = registry.URL
+	cfg.ApplicationSpec.BaseImageSpec = config.DockerBaseImageSpec{BaseImage: "aurora/oracle8", BaseVersion: baseDigest}
+
+	// The image is not built, as the test has no Docker daemon
+	prepared := errors.New("prepared")
+	var preparedVersion *runtime.AuroraVersion
+	var preparedDeliverable nexus.Deliverable
+	prepper := func(cfg *config.Config, auroraVersion *runtime.AuroraVersion, deliverable nexus.Deliverable,
+		baseImage runtime.DockerImage) ([]docker.DockerBuildConfig, error) {
+		preparedVersion = auroraVersion
+		preparedDeliverable = deliverable
+		return nil, prepared
+	}
+
+	err = Build(context.Background(), anonymous, cfg, nexus.NewBinaryDownloader(deliverable.Name()), prepper)
+
+	assert.Equal(t, prepared, errors.Cause(err))
+	assert.Equal(t, deliverable.Name(), preparedDeliverable.Path)
+	assert.True(t, preparedVersion.Snapshot)
+	assert.Equal(t, "SNAPSHOT-feature_AOS-123-42-ab543b3", string(preparedVersion.GetAppVersion()))
+	assert.Equal(t, "feature_AOS-123-SNAPSHOT", preparedVersion.GetGivenVersion())
+	assert.Equal(t, "SNAPSHOT-feature_AOS-123-42-ab543b3-b"+cfg.BuilderSpec.Version+"-oracle8-1.7.0",
+		preparedVersion.GetCompleteVersion())
+}
@@ -0,0 +1,45 @@
+package process
+
+import (
+	"context"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"strings"
+	"time"
+)
+
+const registryHealthTimeout = 10 * time.Second
+
+// selectBaseRegistry returns the registry to get the base image from, with its credentials. Without mirrors this
+// is the external registry. With mirrors, it is the first of the external registry and the mirrors that is up.
+func selectBaseRegistry(ctx context.Context, cfg *config.Config, credentials docker.RegistryCredentialsFunc) (string,
+	*docker.RegistryCredentials, error) {
+	registries := append([]string{cfg.DockerSpec.ExternalDockerRegistry}, cfg.DockerSpec.ExternalDockerRegistryMirrors...)
+	failures := make([]string, 0)
+	for i, registry := range registries {
+		registryCredentials, err := credentials(registry)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "Error reading credentials for base image registry %s", registry)
+		}
+		if len(registries) == 1 {
+			return registry, registryCredentials, nil
+		}
+		healthCtx, cancel := context.WithTimeout(ctx, registryHealthTimeout)
+		err = docker.NewRegistryApi(registry, registryCredentials).Ping(healthCtx)
+		cancel()
+		if err == nil {
+			if i > 0 {
+				logrus.Warnf("Using mirror %s for the base image, as %s", registry, strings.Join(failures, ", "))
+			}
+			return registry, registryCredentials, nil
+		}
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		logrus.Warnf("Base image registry %s is not available: %s", registry, err)
+		failures = append(failures, registry+" is not available")
+	}
+	return "", nil, errors.Errorf("None of the base image registries are available: %s", strings.Join(failures, ", "))
+}
@@ -0,0 +1,60 @@
+package process
+
+import (
+	"context"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func startRegistry(status int) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+}
+
+func anonymous(registry string) (*docker.RegistryCredentials, error) {
+	return nil, nil
+}
+
+func TestSelectBaseRegistryFailsOverToMirror(t *testing.T) {
+	down := startRegistry(http.StatusServiceUnavailable)
+	defer down.Close()
+	denied := startRegistry(http.StatusUnauthorized)
+	defer denied.Close()
+	cfg := &config.Config{DockerSpec: config.DockerSpec{
+		ExternalDockerRegistry:        down.URL,
+		ExternalDockerRegistryMirrors: []string{denied.URL},
+	}}
+
+	registry, _, err := selectBaseRegistry(context.Background(), cfg, anonymous)
+
+	assert.NoError(t, err)
+	assert.Equal(t, denied.URL, registry)
+}
+
+func TestSelectBaseRegistryWithoutAvailableRegistries(t *testing.T) {
+	down := startRegistry(http.StatusBadGateway)
+	defer down.Close()
+	cfg := &config.Config{DockerSpec: config.DockerSpec{
+		ExternalDockerRegistry:        down.URL,
+		ExternalDockerRegistryMirrors: []string{down.URL + "/mirror"},
+	}}
+
+	_, _, err := selectBaseRegistry(context.Background(), cfg, anonymous)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "None of the base image registries are available")
+}
+
+func TestSelectBaseRegistryWithoutMirrorsIsNotChecked(t *testing.T) {
+	cfg := &config.Config{DockerSpec: config.DockerSpec{ExternalDockerRegistry: "https://localhost:1"}}
+
+	registry, _, err := selectBaseRegistry(context.Background(), cfg, anonymous)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://localhost:1", registry)
+}
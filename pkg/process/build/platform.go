@@ -0,0 +1,165 @@
+package process
+
+import (
+	"context"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/nexus"
+	"github.com/skatteetaten/architect/pkg/signing"
+)
+
+// The base image of one platform in a multi-platform build
+type platformImage struct {
+	Platform docker.Platform
+	Image    runtime.DockerImage
+}
+
+// findPlatformBaseImages finds the image of each of the configured platforms in the manifest list of the base
+// image. Returns nil for a single-platform build, that is if no platforms are configured or the base image
+// is not a manifest list.
+func findPlatformBaseImages(ctx context.Context, cfg *config.Config, baseRegistry string,
+	credentials *docker.RegistryCredentials, baseImage runtime.DockerImage) ([]platformImage, error) {
+	if len(cfg.DockerSpec.Platforms) == 0 {
+		return nil, nil
+	}
+	reference := baseImage.Tag
+	if baseImage.Digest != "" {
+		reference = baseImage.Digest
+	}
+	registry := docker.NewRegistryApi(baseRegistry, credentials)
+	list, err := registry.GetManifestList(ctx, baseImage.Repository, reference)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to get the platforms of the base image")
+	}
+	if list == nil {
+		logrus.Warnf("Base image %s is not a manifest list. Building for its platform only",
+			baseImage.GetCompleteDockerTagName())
+		return nil, nil
+	}
+
+	images := make([]platformImage, 0, len(cfg.DockerSpec.Platforms))
+	for _, name := range cfg.DockerSpec.Platforms {
+		wanted, err := docker.ParsePlatform(name)
+		if err != nil {
+			return nil, err
+		}
+		var found *docker.ManifestDescriptor
+		for i, manifest := range list.Manifests {
+			if manifest.Platform != nil && manifest.Platform.Matches(wanted) {
+				found = &list.Manifests[i]
+				break
+			}
+		}
+		if found == nil {
+			return nil, errors.Errorf("Base image %s has no image for platform %s",
+				baseImage.GetCompleteDockerTagName(), name)
+		}
+		image := baseImage
+		image.Digest = found.Digest
+		logrus.Infof("Using base image %s for %s", image.GetCompleteDockerTagName(), found.Platform)
+		images = append(images, platformImage{Platform: *found.Platform, Image: image})
+	}
+	return images, nil
+}
+
+// preparePlatforms prepares the images of each platform, with the base image of the platform in FROM
+func preparePlatforms(cfg *config.Config, prepper Prepper, auroraVersion *runtime.AuroraVersion,
+	deliverable nexus.Deliverable, platformBaseImages []platformImage) ([]docker.DockerBuildConfig, error) {
+	buildConfigs := make([]docker.DockerBuildConfig, 0)
+	for _, base := range platformBaseImages {
+		prepared, err := prepper(cfg, auroraVersion, deliverable, base.Image)
+		if err != nil {
+			return buildConfigs, errors.Wrapf(err, "Error preparing image for %s", base.Platform)
+		}
+		for _, buildConfig := range prepared {
+			platform := base.Platform
+			buildConfig.Platform = &platform
+			buildConfigs = append(buildConfigs, buildConfig)
+		}
+	}
+	return buildConfigs, nil
+}
+
+// checkPlatforms checks that the Docker daemon can run the base image of each platform, so that a missing
+// emulator fails the build before the image of any platform is pushed
+func checkPlatforms(ctx context.Context, client *docker.DockerClient, credentials docker.RegistryCredentialsFunc,
+	platformBaseImages []platformImage) error {
+	for _, base := range platformBaseImages {
+		baseCredentials, err := credentials(base.Image.Registry)
+		if err != nil {
+			return errors.Wrap(err, "Error reading credentials for the base image registry")
+		}
+		if err := client.PullImage(ctx, base.Image, baseCredentials); err != nil {
+			return errors.Wrapf(err, "Failed to pull base image %s", base.Image.GetCompleteDockerTagName())
+		}
+		if err := client.CheckPlatform(ctx, base.Image, base.Platform); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The image of each platform is pushed with its own tag, e.g. 1.2.3-b1.0.0-oracle8-1.0.0-linux-arm64
+func platformTag(cfg *config.Config, buildConfig docker.DockerBuildConfig) string {
+	tag := buildConfig.AuroraVersion.GetCompleteVersion() + "-" + buildConfig.Platform.TagSuffix()
+	return docker.CreateImageNameFromSpecAndTags([]string{tag}, cfg.DockerSpec.OutputRegistry,
+		buildConfig.DockerRepository)[0]
+}
+
+// pushManifestLists pushes a manifest list of the platform images of each repository under the tags of the build.
+// Returns the tags.
+func pushManifestLists(ctx context.Context, cfg *config.Config, provider docker.ImageInfoProvider, signer *signing.Signer,
+	credentials *docker.RegistryCredentials, buildConfigs []docker.DockerBuildConfig) ([]string, error) {
+	repositories := make([]string, 0)
+	platformImages := make(map[string][]docker.DockerBuildConfig)
+	for _, buildConfig := range buildConfigs {
+		if _, ok := platformImages[buildConfig.DockerRepository]; !ok {
+			repositories = append(repositories, buildConfig.DockerRepository)
+		}
+		platformImages[buildConfig.DockerRepository] = append(platformImages[buildConfig.DockerRepository], buildConfig)
+	}
+
+	registry := docker.NewRegistryApi(cfg.DockerSpec.OutputRegistry, credentials)
+	pushed := make([]string, 0)
+	for _, repository := range repositories {
+		images := platformImages[repository]
+		manifests := make([]docker.ManifestDescriptor, 0, len(images))
+		for _, image := range images {
+			_, _, reference, err := signing.ParseImageName(platformTag(cfg, image))
+			if err != nil {
+				return pushed, err
+			}
+			manifest, err := registry.SetImagePlatform(ctx, repository, reference, *image.Platform)
+			if err != nil {
+				return pushed, errors.Wrapf(err, "Failed to set the platform of %s", platformTag(cfg, image))
+			}
+			manifests = append(manifests, *manifest)
+		}
+		list := docker.NewManifestList(manifests)
+
+		tags, err := resolveTags(ctx, cfg, provider, images[0])
+		if err != nil {
+			return pushed, err
+		}
+		logrus.Infof("Push manifest list of %d platforms with %s", len(manifests), tags)
+		for _, tag := range tags {
+			_, _, reference, err := signing.ParseImageName(tag)
+			if err != nil {
+				return pushed, err
+			}
+			if _, err := registry.PutManifestList(ctx, repository, reference, list); err != nil {
+				return pushed, err
+			}
+			pushed = append(pushed, tag)
+		}
+		if signer != nil && len(tags) > 0 {
+			if err := signer.SignImageName(ctx, tags[0]); err != nil {
+				return pushed, errors.Wrap(err, "Error signing image")
+			}
+		}
+	}
+	return pushed, nil
+}
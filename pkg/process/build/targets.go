@@ -0,0 +1,204 @@
+package process
+
+import (
+	"context"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/process/progress"
+	"github.com/skatteetaten/architect/pkg/signing"
+	"github.com/skatteetaten/architect/pkg/util"
+	"strings"
+	"sync"
+)
+
+// outputTarget is a registry the image is pushed to, with what is needed to resolve its tags, and to push and
+// sign the image there. The output registry of the build is the primary target.
+type outputTarget struct {
+	cfg         *config.Config
+	primary     bool
+	provider    docker.ImageInfoProvider
+	credentials *docker.RegistryCredentials
+	signer      *signing.Signer
+	mutex       sync.Mutex
+	err         error
+}
+
+// newOutputTargets creates the targets in the order they are pushed to. The output registry uses the provider,
+// credentials and signer of the build.
+func newOutputTargets(cfg *config.Config, credentials docker.RegistryCredentialsFunc, retry util.RetryPolicy,
+	provider docker.ImageInfoProvider, outputCredentials *docker.RegistryCredentials,
+	signer *signing.Signer) ([]*outputTarget, error) {
+	targets := make([]*outputTarget, 0)
+	for _, targetCfg := range cfg.OutputConfigs() {
+		if targetCfg == cfg {
+			targets = append(targets, &outputTarget{
+				cfg:         cfg,
+				primary:     true,
+				provider:    provider,
+				credentials: outputCredentials,
+				signer:      signer,
+			})
+			continue
+		}
+		registry := targetCfg.DockerSpec.OutputRegistry
+		targetCredentials, err := credentials(registry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error reading credentials for output target %s", registry)
+		}
+		targetSigner, err := signing.NewSigner(targetCfg, targetCredentials)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error initializing image signing for output target %s", registry)
+		}
+		targets = append(targets, &outputTarget{
+			cfg:         targetCfg,
+			provider:    docker.NewRegistryClient("https://"+strings.TrimPrefix(registry, "https://"), retry, targetCredentials),
+			credentials: targetCredentials,
+			signer:      targetSigner,
+		})
+	}
+	return targets, nil
+}
+
+func (m *outputTarget) name() string {
+	return m.cfg.DockerSpec.OutputRegistry + "/" + m.cfg.DockerSpec.OutputRepository
+}
+
+// The phases of the output registry keep their names, so that builds without targets log as before
+func (m *outputTarget) phase(name string) string {
+	if m.primary {
+		return name
+	}
+	return name + " " + m.cfg.DockerSpec.OutputRegistry
+}
+
+// buildConfig returns the build config with the repository of the target
+func (m *outputTarget) buildConfig(buildConfig docker.DockerBuildConfig) docker.DockerBuildConfig {
+	buildConfig.DockerRepository = m.cfg.DockerSpec.OutputRepository
+	return buildConfig
+}
+
+func (m *outputTarget) fail(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+func (m *outputTarget) failed() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.err
+}
+
+// push tags the image with the tags of the target and pushes them. The image of a platform is tagged with the
+// platform tag only, and is signed through the manifest list.
+func (m *outputTarget) push(ctx context.Context, client *docker.DockerClient, phases *progress.Progress,
+	buildConfig docker.DockerBuildConfig, imageid string) ([]string, error) {
+	timeouts := m.cfg.TimeoutSpec
+	buildConfig = m.buildConfig(buildConfig)
+	var tags []string
+	err := phases.Run(ctx, m.phase("tag"), func(ctx context.Context) error {
+		var err error
+		if buildConfig.Platform != nil {
+			tags = []string{platformTag(m.cfg, buildConfig)}
+			logrus.Infof("Tag %s image %s with %s", buildConfig.Platform, imageid, tags[0])
+			err = client.TagImage(ctx, imageid, tags[0])
+		} else {
+			tags, err = tagImage(ctx, client, m.cfg, m.provider, buildConfig, imageid)
+		}
+		return phaseError(ctx, err, "Tag", timeouts.Push)
+	})
+	if err != nil {
+		return nil, err
+	}
+	imageSigner := m.signer
+	if buildConfig.Platform != nil {
+		imageSigner = nil
+	}
+	err = phases.Run(ctx, m.phase("push"), func(ctx context.Context) error {
+		return phaseError(ctx, push(ctx, client, imageSigner, m.credentials, tags), "Push", timeouts.Push)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// pushImages pushes the images of the build to the target, and returns the tags pushed. The images of a
+// Node.js build, and of each platform, are pushed concurrently. The manifest lists of a multi-platform build
+// are pushed when the images of all platforms are in the target.
+func (m *outputTarget) pushImages(ctx context.Context, client *docker.DockerClient, phases *progress.Progress,
+	buildConfigs []docker.DockerBuildConfig, imageids []string, multiPlatform bool) ([]string, error) {
+	timeouts := m.cfg.TimeoutSpec
+	pushCtx, cancelPush := util.WithTimeout(ctx, timeouts.Push)
+	defer cancelPush()
+	imageTags := make([][]string, len(buildConfigs))
+	err := util.RunConcurrently(pushCtx, len(buildConfigs), m.cfg.Concurrency, func(ctx context.Context, i int) error {
+		var err error
+		imageTags[i], err = m.push(ctx, client, phases, buildConfigs[i], imageids[i])
+		return err
+	})
+	pushed := make([]string, 0)
+	for _, tags := range imageTags {
+		pushed = append(pushed, tags...)
+	}
+	if err != nil || !multiPlatform {
+		return pushed, err
+	}
+
+	listCtx, cancelList := util.WithTimeout(ctx, timeouts.Push)
+	defer cancelList()
+	var tags []string
+	err = phases.Run(listCtx, m.phase("manifest list"), func(ctx context.Context) error {
+		targetConfigs := make([]docker.DockerBuildConfig, len(buildConfigs))
+		for i, buildConfig := range buildConfigs {
+			targetConfigs[i] = m.buildConfig(buildConfig)
+		}
+		var err error
+		tags, err = pushManifestLists(ctx, m.cfg, m.provider, m.signer, m.credentials, targetConfigs)
+		return phaseError(ctx, err, "Manifest list", timeouts.Push)
+	})
+	return append(tags, pushed...), err
+}
+
+// forEachTarget runs the operation for each target in order, and returns the tags pushed. In atomic mode the
+// first failure stops the push. In best-effort mode a failed target is skipped from then on, and only a failure
+// of the output registry fails the build.
+func forEachTarget(targets []*outputTarget, operation func(target *outputTarget) ([]string, error)) ([]string, error) {
+	pushed := make([]string, 0)
+	for _, target := range targets {
+		if target.failed() != nil {
+			continue
+		}
+		tags, err := operation(target)
+		pushed = append(pushed, tags...)
+		if err == nil {
+			continue
+		}
+		target.fail(err)
+		if target.primary {
+			return pushed, err
+		}
+		if target.cfg.DockerSpec.OutputMode != config.BestEffortOutput {
+			return pushed, errors.Wrapf(err, "Failed to push to output target %s", target.name())
+		}
+		logrus.Warnf("Failed to push to output target %s: %s", target.name(), err)
+	}
+	return pushed, nil
+}
+
+// targetStatus tells which targets the image was pushed to, for the build summary
+func targetStatus(targets []*outputTarget) []string {
+	status := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if err := target.failed(); err != nil {
+			status = append(status, target.name()+" "+progress.Failed+": "+err.Error())
+		} else {
+			status = append(status, target.name()+" "+progress.Succeeded)
+		}
+	}
+	return status
+}
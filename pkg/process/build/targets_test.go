@@ -0,0 +1,89 @@
+package process
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/process/progress"
+	"github.com/skatteetaten/architect/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// dockerDaemonMock records the pushes, and refuses pushes to the registry in failRegistry
+type dockerDaemonMock struct {
+	failRegistry string
+	mutex        *sync.Mutex
+	pushed       *[]string
+}
+
+func (m dockerDaemonMock) ImageBuild(ctx context.Context, context io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+	return types.ImageBuildResponse{}, errors.New("Not supported")
+}
+
+func (m dockerDaemonMock) ImagePush(ctx context.Context, ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
+	if strings.HasPrefix(ref, m.failRegistry+"/") {
+		return nil, errors.New("Service unavailable")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	*m.pushed = append(*m.pushed, ref)
+	return ioutil.NopCloser(strings.NewReader(`{"status":"Pushed"}`)), nil
+}
+
+func (m dockerDaemonMock) ImageTag(ctx context.Context, image string, ref string) error {
+	return nil
+}
+
+func (m dockerDaemonMock) ImagePull(ctx context.Context, image string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	return nil, errors.New("Not supported")
+}
+
+func TestAtomicPushWithFailedTarget(t *testing.T) {
+	cfg := &config.Config{DockerSpec: config.DockerSpec{
+		OutputRegistry:   "registry.aurora.no",
+		OutputRepository: "aurora/app",
+		TagWith:          "temporary",
+		OutputMode:       config.AtomicOutput,
+		OutputTargets: []config.OutputTarget{
+			{Registry: "dr-registry.aurora.no"},
+			{Registry: "registry.partner.no"},
+		},
+	}}
+	targets, err := newOutputTargets(cfg, anonymous, util.RetryPolicy{}, nil, nil, nil)
+	assert.NoError(t, err)
+	pushed := make([]string, 0)
+	client := &docker.DockerClient{Client: dockerDaemonMock{
+		failRegistry: "registry.partner.no",
+		mutex:        &sync.Mutex{},
+		pushed:       &pushed,
+	}}
+	auroraVersion := runtime.NewAuroraVersion("1.2.3", false, "1.2.3", "1.2.3-b1.0.0-oracle8-1.0.0")
+	buildConfigs := []docker.DockerBuildConfig{
+		{AuroraVersion: auroraVersion, DockerRepository: "aurora/app"},
+		{AuroraVersion: auroraVersion, DockerRepository: "aurora/app"},
+	}
+
+	_, err = forEachTarget(targets, func(target *outputTarget) ([]string, error) {
+		return target.pushImages(context.Background(), client, progress.New("Build"), buildConfigs,
+			[]string{"image1", "image2"}, false)
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed to push to output target registry.partner.no/aurora/app")
+	// Both images are in the first target, and none are in the output registry
+	assert.Equal(t, []string{
+		"dr-registry.aurora.no/aurora/app:temporary",
+		"dr-registry.aurora.no/aurora/app:temporary",
+	}, pushed)
+	assert.Nil(t, targets[0].failed())
+	assert.Error(t, targets[1].failed())
+	assert.True(t, targets[2].primary)
+}
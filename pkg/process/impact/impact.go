@@ -0,0 +1,125 @@
+package impact
+
+import (
+	"context"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/util"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Query tells which base image to look for. The base image is either a version, which is found in the
+// complete version tag of the images, or a digest, which is found in the base image label of the images.
+type Query struct {
+	BaseImage   string
+	BaseVersion string
+	BaseDigest  string
+	// Only repositories with this prefix are searched, e.g. aurora/
+	Prefix string
+}
+
+// Image is an image built on the base image
+type Image struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+}
+
+type Report struct {
+	Registry    string  `json:"registry"`
+	BaseImage   string  `json:"baseImage"`
+	BaseVersion string  `json:"baseVersion,omitempty"`
+	BaseDigest  string  `json:"baseDigest,omitempty"`
+	Images      []Image `json:"images"`
+	// Repositories that could not be searched
+	Failed []string `json:"failed,omitempty"`
+}
+
+// Analyze walks the catalog of the registry and finds the images built on the base image. The repositories
+// are searched concurrently. A repository that can not be searched is logged and reported as failed.
+func Analyze(ctx context.Context, registry *docker.RegistryApi, address string, query Query, concurrency int) (*Report, error) {
+	if query.BaseImage == "" || (query.BaseVersion == "") == (query.BaseDigest == "") {
+		return nil, errors.New("Expected a base image with either a version or a digest")
+	}
+	repositories, err := registry.GetCatalog(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get the catalog of %s", address)
+	}
+	searched := make([]string, 0, len(repositories))
+	for _, repository := range repositories {
+		if strings.HasPrefix(repository, query.Prefix) {
+			searched = append(searched, repository)
+		}
+	}
+	logrus.Infof("Searching %d of %d repositories in %s", len(searched), len(repositories), address)
+
+	report := &Report{
+		Registry:    address,
+		BaseImage:   query.BaseImage,
+		BaseVersion: query.BaseVersion,
+		BaseDigest:  query.BaseDigest,
+		Images:      make([]Image, 0),
+	}
+	// The workers share the registry client, which keeps the token of each repository apart
+	var mutex sync.Mutex
+	err = util.RunConcurrently(ctx, len(searched), concurrency, func(ctx context.Context, i int) error {
+		tags, err := findTags(ctx, registry, searched[i], query)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			logrus.Warnf("Failed to search %s: %s", searched[i], err)
+			report.Failed = append(report.Failed, searched[i])
+			return nil
+		}
+		for _, tag := range tags {
+			report.Images = append(report.Images, Image{Repository: searched[i], Tag: tag})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(report.Images, func(i, j int) bool {
+		if report.Images[i].Repository != report.Images[j].Repository {
+			return report.Images[i].Repository < report.Images[j].Repository
+		}
+		return report.Images[i].Tag < report.Images[j].Tag
+	})
+	sort.Strings(report.Failed)
+	return report, nil
+}
+
+// findTags finds the tags of the repository that are built on the base image. The complete version tag ends
+// with the name and version of the base image, e.g. 2.0.0-b1.11.0-oracle8-1.0.2. To search by digest, the
+// config of each complete version tag with the name of the base image is read.
+func findTags(ctx context.Context, registry *docker.RegistryApi, repository string, query Query) ([]string, error) {
+	tags, err := registry.ListTags(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+	baseImage := runtime.DockerImage{Repository: query.BaseImage, Tag: query.BaseVersion}
+	component := "-" + baseImage.AuroraVersionComponent()
+	found := make([]string, 0)
+	for _, tag := range tags {
+		if query.BaseDigest == "" {
+			if strings.HasSuffix(tag, component) {
+				found = append(found, tag)
+			}
+			continue
+		}
+		if !strings.Contains(tag, component) {
+			continue
+		}
+		imageConfig, err := registry.GetImageConfig(ctx, repository, tag)
+		if err != nil {
+			return nil, err
+		}
+		if imageConfig.Labels[docker.LABEL_OCI_BASE_DIGEST] == query.BaseDigest {
+			found = append(found, tag)
+		}
+	}
+	return found, nil
+}
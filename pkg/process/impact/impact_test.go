@@ -0,0 +1,162 @@
+package impact_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/process/impact"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const oldBaseDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+const newBaseDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+// The images have the base digest label of their base image
+var registryTags = map[string]map[string]string{
+	"aurora/console": {
+		"2.0.0-b1.11.0-oracle8-1.0.2": oldBaseDigest,
+		"2.1.0-b1.11.0-oracle8-1.0.3": newBaseDigest,
+		"2.0":                         oldBaseDigest,
+		"latest":                      newBaseDigest,
+	},
+	"aurora/boober": {
+		"1.0.0-b1.11.0-oracle8-1.0.2": oldBaseDigest,
+	},
+	"aurora/wrench": {
+		"1.0.0-b1.11.0-wrench-1.0.2": oldBaseDigest,
+	},
+	"other/app": {
+		"3.0.0-b1.11.0-oracle8-1.0.2": oldBaseDigest,
+	},
+	"aurora/broken": nil,
+}
+
+func startRegistry(t *testing.T) *httptest.Server {
+	return startTokenRegistry(t, false)
+}
+
+// startTokenRegistry requires a bearer token for each repository when tokens is set, like Docker Hub, Harbor and
+// the OpenShift registry
+func startTokenRegistry(t *testing.T, tokens bool) *httptest.Server {
+	manifests := make(map[string][]byte)
+	blobs := make(map[string][]byte)
+	for repository, tags := range registryTags {
+		for tag, baseDigest := range tags {
+			config := []byte(fmt.Sprintf(`{"config": {"Labels": {"%s": "%s"}}}`, docker.LABEL_OCI_BASE_DIGEST, baseDigest))
+			blobs[docker.Digest(config)] = config
+			manifests[repository+":"+tag] = []byte(fmt.Sprintf(`{"schemaVersion": 2, "mediaType": "%s", "config": {"digest": "%s"}}`,
+				docker.MediaTypeManifestV2, docker.Digest(config)))
+		}
+	}
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(map[string]string{"token": "token-" + r.URL.Query().Get("scope")})
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+		scope := "registry:catalog:*"
+		if i := strings.Index(path, "/tags/"); i >= 0 {
+			scope = "repository:" + path[:i] + ":pull"
+		} else if i := strings.Index(path, "/manifests/"); i >= 0 {
+			scope = "repository:" + path[:i] + ":pull"
+		} else if i := strings.Index(path, "/blobs/"); i >= 0 {
+			scope = "repository:" + path[:i] + ":pull"
+		}
+		if tokens && r.Header.Get("Authorization") != "Bearer token-"+scope {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="%s"`,
+				server.URL, scope))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case path == "_catalog" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/_catalog?last=aurora%2Fconsole&n=3>; rel="next"`)
+			json.NewEncoder(w).Encode(map[string][]string{"repositories": {"aurora/boober", "aurora/broken", "aurora/console"}})
+		case path == "_catalog":
+			json.NewEncoder(w).Encode(map[string][]string{"repositories": {"aurora/wrench", "other/app"}})
+		case strings.HasSuffix(path, "/tags/list"):
+			repository := strings.TrimSuffix(path, "/tags/list")
+			if registryTags[repository] == nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			tags := make([]string, 0)
+			for tag := range registryTags[repository] {
+				tags = append(tags, tag)
+			}
+			json.NewEncoder(w).Encode(docker.TagsAPIResponse{Name: repository, Tags: tags})
+		case strings.Contains(path, "/manifests/"):
+			parts := strings.SplitN(path, "/manifests/", 2)
+			manifest, ok := manifests[parts[0]+":"+parts[1]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", docker.MediaTypeManifestV2)
+			w.Write(manifest)
+		case strings.Contains(path, "/blobs/"):
+			w.Write(blobs[path[strings.LastIndex(path, "/")+1:]])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestAnalyzeByVersion(t *testing.T) {
+	server := startRegistry(t)
+	defer server.Close()
+
+	report, err := impact.Analyze(context.Background(), docker.NewRegistryApi(server.URL, nil), "registry",
+		impact.Query{BaseImage: "aurora/oracle8", BaseVersion: "1.0.2", Prefix: "aurora/"}, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []impact.Image{
+		{Repository: "aurora/boober", Tag: "1.0.0-b1.11.0-oracle8-1.0.2"},
+		{Repository: "aurora/console", Tag: "2.0.0-b1.11.0-oracle8-1.0.2"},
+	}, report.Images)
+	assert.Equal(t, []string{"aurora/broken"}, report.Failed)
+}
+
+func TestAnalyzeByDigest(t *testing.T) {
+	server := startRegistry(t)
+	defer server.Close()
+
+	report, err := impact.Analyze(context.Background(), docker.NewRegistryApi(server.URL, nil), "registry",
+		impact.Query{BaseImage: "aurora/oracle8", BaseDigest: newBaseDigest}, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []impact.Image{
+		{Repository: "aurora/console", Tag: "2.1.0-b1.11.0-oracle8-1.0.3"},
+	}, report.Images)
+}
+
+func TestAnalyzeWithRepositoryTokens(t *testing.T) {
+	server := startTokenRegistry(t, true)
+	defer server.Close()
+
+	report, err := impact.Analyze(context.Background(), docker.NewRegistryApi(server.URL, nil), "registry",
+		impact.Query{BaseImage: "aurora/oracle8", BaseDigest: oldBaseDigest}, 4)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []impact.Image{
+		{Repository: "aurora/boober", Tag: "1.0.0-b1.11.0-oracle8-1.0.2"},
+		{Repository: "aurora/console", Tag: "2.0.0-b1.11.0-oracle8-1.0.2"},
+		{Repository: "other/app", Tag: "3.0.0-b1.11.0-oracle8-1.0.2"},
+	}, report.Images)
+	assert.Equal(t, []string{"aurora/broken"}, report.Failed)
+}
+
+func TestAnalyzeRequiresVersionOrDigest(t *testing.T) {
+	_, err := impact.Analyze(context.Background(), docker.NewRegistryApi("registry", nil), "registry",
+		impact.Query{BaseImage: "aurora/oracle8"}, 2)
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/skatteetaten/architect/pkg/tracing"
+	"sync"
+	"time"
+)
+
+const (
+	Succeeded = "succeeded"
+	Failed    = "failed"
+)
+
+type Phase struct {
+	Name     string
+	Duration time.Duration
+	Status   string
+}
+
+// Progress logs the phases of a build or retag, and a summary when it is done. Each log entry has the
+// phase as a field, so that the phases can be found in the log aggregation. Phases may run concurrently.
+type Progress struct {
+	Operation string
+	Phases    []Phase
+	start     time.Time
+	fields    logrus.Fields
+	mutex     sync.Mutex
+}
+
+func New(operation string) *Progress {
+	return &Progress{
+		Operation: operation,
+		start:     time.Now(),
+		fields:    logrus.Fields{},
+	}
+}
+
+// Run runs a phase and records its duration. The phase is traced as a span, if there is a tracer in ctx.
+// The error of the phase is returned as is.
+func (m *Progress) Run(ctx context.Context, name string, phase func(ctx context.Context) error) error {
+	logger := logrus.WithField("phase", name)
+	logger.Infof("Phase %s started", name)
+	ctx, span := tracing.StartSpan(ctx, name, tracing.KindInternal)
+	start := time.Now()
+	err := phase(ctx)
+	duration := time.Since(start)
+	span.Finish(err)
+
+	status := Succeeded
+	if err != nil {
+		status = Failed
+	}
+	m.mutex.Lock()
+	m.Phases = append(m.Phases, Phase{Name: name, Duration: duration, Status: status})
+	m.mutex.Unlock()
+	logger.WithFields(logrus.Fields{
+		"duration_ms": durationMillis(duration),
+		"status":      status,
+	}).Infof("Phase %s %s in %s", name, status, formatDuration(duration))
+	return err
+}
+
+// Duration is the time since the progress was created
+func (m *Progress) Duration() time.Duration {
+	return time.Since(m.start)
+}
+
+// Set adds a field to the summary, e.g. the pushed image
+func (m *Progress) Set(key string, value interface{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.fields[key] = value
+}
+
+// Summary logs the outcome, the fields and the duration of each phase. With the text format this is
+// rendered as a block at the end of the build log.
+func (m *Progress) Summary(err error) {
+	status := Succeeded
+	if err != nil {
+		status = Failed
+	}
+	duration := m.Duration()
+	summary := logrus.Fields{
+		"duration_ms": durationMillis(duration),
+		"status":      status,
+	}
+	for key, value := range m.fields {
+		summary[key] = value
+	}
+	logrus.WithFields(summary).Infof("%s %s in %s", m.Operation, status, formatDuration(duration))
+	for _, phase := range m.Phases {
+		logrus.WithFields(logrus.Fields{
+			"phase":       phase.Name,
+			"duration_ms": durationMillis(phase.Duration),
+			"status":      phase.Status,
+		}).Infof("  %-14s %8s  %s", phase.Name, formatDuration(phase.Duration), phase.Status)
+	}
+}
+
+func durationMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
@@ -0,0 +1,58 @@
+package progress_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/process/progress"
+	"github.com/skatteetaten/architect/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestPhasesAndSummaryAsJson(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logrus.SetOutput(buffer)
+	defer logrus.SetOutput(os.Stderr)
+	assert.NoError(t, util.SetLogFormat(util.JsonLogFormat))
+	defer util.SetLogFormat(util.TextLogFormat)
+
+	p := progress.New("Build")
+	assert.NoError(t, p.Run(context.Background(), "download", func(ctx context.Context) error { return nil }))
+	failure := errors.New("Step 2 failed")
+	assert.Equal(t, failure, p.Run(context.Background(), "build", func(ctx context.Context) error { return failure }))
+	p.Set("version", "1.2.3-b1.0.0-oracle8-1.7.0")
+	p.Summary(failure)
+
+	entries := make([]map[string]interface{}, 0)
+	scanner := bufio.NewScanner(buffer)
+	for scanner.Scan() {
+		entry := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	assert.Len(t, entries, 7)
+
+	assert.Equal(t, "download", entries[1]["phase"])
+	assert.Equal(t, progress.Succeeded, entries[1]["status"])
+	assert.Contains(t, entries[1], "duration_ms")
+	assert.Equal(t, "build", entries[3]["phase"])
+	assert.Equal(t, progress.Failed, entries[3]["status"])
+
+	summary := entries[4]
+	assert.Equal(t, progress.Failed, summary["status"])
+	assert.Equal(t, "1.2.3-b1.0.0-oracle8-1.7.0", summary["version"])
+	assert.Equal(t, "download", entries[5]["phase"])
+	assert.Equal(t, "build", entries[6]["phase"])
+
+	assert.Len(t, p.Phases, 2)
+	assert.Equal(t, progress.Failed, p.Phases[1].Status)
+}
+
+func TestUnknownLogFormat(t *testing.T) {
+	assert.Error(t, util.SetLogFormat("xml"))
+}
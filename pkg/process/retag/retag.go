@@ -1,54 +1,350 @@
 package retag
 
 import (
+	"context"
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 	"github.com/skatteetaten/architect/pkg/config"
 	"github.com/skatteetaten/architect/pkg/config/runtime"
 	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/metrics"
+	"github.com/skatteetaten/architect/pkg/process/progress"
+	"github.com/skatteetaten/architect/pkg/process/tagger"
+	"github.com/skatteetaten/architect/pkg/signing"
+	"github.com/skatteetaten/architect/pkg/tracing"
+	"github.com/skatteetaten/architect/pkg/util"
+	"strings"
+	"time"
 )
 
 type retagger struct {
 	Config      *config.Config
-	Credentials *docker.RegistryCredentials
+	Credentials docker.RegistryCredentialsFunc
+	Progress    *progress.Progress
+	client      *docker.DockerClient
 }
 
-func newRetagger(cfg *config.Config, credentials *docker.RegistryCredentials) *retagger {
+func newRetagger(cfg *config.Config, credentials docker.RegistryCredentialsFunc) *retagger {
 	return &retagger{
 		Config:      cfg,
 		Credentials: credentials,
+		Progress:    progress.New("Retag"),
 	}
 }
 
-func Retag(cfg *config.Config, credentials *docker.RegistryCredentials) error {
+// Retag is stopped when ctx is cancelled, and is limited by the push timeout in the config. Credentials are
+// resolved for the registry of each operation.
+func Retag(ctx context.Context, cfg *config.Config, credentials docker.RegistryCredentialsFunc) error {
 	r := newRetagger(cfg, credentials)
-	return r.Retag()
+	tracer := tracing.NewTracer(cfg)
+	ctx, span := tracing.StartSpan(tracing.WithTracer(ctx, tracer), "retag", tracing.KindInternal)
+	ctx, cancel := util.WithTimeout(ctx, cfg.TimeoutSpec.Push)
+	defer cancel()
+	err := r.Retag(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = errors.Wrapf(err, "Retag timed out after %s", cfg.TimeoutSpec.Push)
+	}
+	r.Progress.Summary(err)
+
+	run := metrics.NewRun("retag", cfg, r.Progress, err)
+	if r.client != nil {
+		run.PushedBytes = r.client.PushedBytes()
+	}
+	metrics.Export(cfg.MetricsSpec, run)
+	span.Finish(err)
+	tracer.Export(cfg.TracingSpec)
+	return err
+}
+
+// retagTarget is a registry the temporary image is retagged in. The build pushes the temporary image to each
+// output target, so each target has its own copy to retag.
+type retagTarget struct {
+	cfg         *config.Config
+	primary     bool
+	provider    docker.ImageInfoProvider
+	credentials *docker.RegistryCredentials
+	tags        []string
+	err         error
+}
+
+func (m *retagTarget) name() string {
+	return m.cfg.DockerSpec.OutputRegistry + "/" + m.cfg.DockerSpec.OutputRepository
+}
+
+// The phases of the output registry keep their names, so that retags without targets log as before
+func (m *retagTarget) phase(name string) string {
+	if m.primary {
+		return name
+	}
+	return name + " " + m.cfg.DockerSpec.OutputRegistry
+}
+
+func (m *retagger) Retag(ctx context.Context) error {
+	imageId := runtime.DockerImage{
+		Registry:   m.Config.DockerSpec.OutputRegistry,
+		Repository: m.Config.DockerSpec.OutputRepository,
+		Tag:        m.Config.DockerSpec.RetagWith,
+	}
+	m.Progress.Set("image", imageId.GetCompleteDockerTagName())
+
+	targets, err := m.newTargets()
+	if err != nil {
+		return err
+	}
+
+	err = m.Progress.Run(ctx, "resolve tags", func(ctx context.Context) error {
+		version, err := m.readVersion(ctx)
+		if err != nil {
+			return err
+		}
+		return m.forEachTarget(targets, func(target *retagTarget) error {
+			var err error
+			target.tags, err = m.resolveTags(ctx, target, version)
+			return err
+		})
+	})
+	if err == nil {
+		err = m.forEachTarget(targets, func(target *retagTarget) error {
+			return m.retagTarget(ctx, target)
+		})
+	}
+	if len(targets) > 1 {
+		m.Progress.Set("targets", targetStatus(targets))
+	}
+	if err != nil {
+		return err
+	}
+	tags := make([]string, 0)
+	for _, target := range targets {
+		if target.err == nil {
+			tags = append(tags, target.tags...)
+		}
+	}
+	m.Progress.Set("tags", tags)
+	return nil
 }
 
-func (m *retagger) Retag() error {
+// newTargets creates the targets in the order they are retagged. The output registry resolves its tags against
+// the external registry, as it always has.
+func (m *retagger) newTargets() ([]*retagTarget, error) {
+	retry := m.Config.RetrySpec.RetryPolicy()
+	targets := make([]*retagTarget, 0)
+	for _, cfg := range m.Config.OutputConfigs() {
+		registry := cfg.DockerSpec.OutputRegistry
+		credentials, err := m.Credentials(registry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read credentials for the output registry %s", registry)
+		}
+		target := &retagTarget{
+			cfg:         cfg,
+			primary:     cfg == m.Config,
+			credentials: credentials,
+		}
+		if target.primary {
+			externalCredentials, err := m.Credentials(cfg.DockerSpec.ExternalDockerRegistry)
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed to read registry credentials")
+			}
+			target.provider = docker.NewRegistryClient(cfg.DockerSpec.ExternalDockerRegistry, retry, externalCredentials)
+		} else {
+			target.provider = docker.NewRegistryClient("https://"+strings.TrimPrefix(registry, "https://"), retry,
+				credentials)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// forEachTarget runs the operation for each target in order. In atomic mode the first failure stops the retag.
+// In best-effort mode a failed target is skipped from then on, and only a failure of the output registry fails
+// the retag.
+func (m *retagger) forEachTarget(targets []*retagTarget, operation func(target *retagTarget) error) error {
+	for _, target := range targets {
+		if target.err != nil {
+			continue
+		}
+		err := operation(target)
+		if err == nil {
+			continue
+		}
+		target.err = err
+		if target.primary {
+			return err
+		}
+		if target.cfg.DockerSpec.OutputMode != config.BestEffortOutput {
+			return errors.Wrapf(err, "Failed to retag in output target %s", target.name())
+		}
+		logrus.Warnf("Failed to retag in output target %s: %s", target.name(), err)
+	}
+	return nil
+}
+
+func targetStatus(targets []*retagTarget) []string {
+	status := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if target.err != nil {
+			status = append(status, target.name()+" "+progress.Failed+": "+target.err.Error())
+		} else {
+			status = append(status, target.name()+" "+progress.Succeeded)
+		}
+	}
+	return status
+}
+
+// retagTarget pulls the temporary image from the registry of the target, and pushes it with the tags of the target
+func (m *retagger) retagTarget(ctx context.Context, target *retagTarget) error {
+	imageId := runtime.DockerImage{
+		Registry:   target.cfg.DockerSpec.OutputRegistry,
+		Repository: target.cfg.DockerSpec.OutputRepository,
+		Tag:        target.cfg.DockerSpec.RetagWith,
+	}
+	tagsToPush := target.tags
+
+	// A multi-platform image can not be pulled, as the daemon only pulls the image of its own platform
+	if len(target.cfg.DockerSpec.Platforms) > 0 {
+		retagged, err := m.retagManifestList(ctx, target)
+		if err != nil || retagged {
+			return err
+		}
+	}
+
+	if m.client == nil {
+		client, err := docker.NewDockerClient(m.Config.RetrySpec.RetryPolicy(), m.Config.Concurrency)
+		if err != nil {
+			return errors.Wrap(err, "Error initializing Docker")
+		}
+		m.client = client
+	}
+	client := m.client
+
+	//We need to pull to make sure we push the newest image.. We should probably do this directly
+	//on the registry when we get v2 registry!:)
+	err := m.Progress.Run(ctx, target.phase("pull"), func(ctx context.Context) error {
+		if err := client.PullImage(ctx, imageId, target.credentials); err != nil {
+			return errors.Wrapf(err, "Failed to pull temporary image %s", imageId.GetCompleteDockerTagName())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = m.Progress.Run(ctx, target.phase("tag"), func(ctx context.Context) error {
+		logrus.Debugf("Retagging temporary image, tags=%-v", tagsToPush)
+		for _, tag := range tagsToPush {
+			sourceTag := imageId.GetCompleteDockerTagName()
+			logrus.Infof("Tag image %s with alias %s", sourceTag, tag)
+			err := client.TagImage(ctx, sourceTag, tag)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to tag image %s with tag %s", imageId, tag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.Progress.Run(ctx, target.phase("push"), func(ctx context.Context) error {
+		if err := client.PushImages(ctx, tagsToPush, target.credentials); err != nil {
+			return err
+		}
+
+		signer, err := signing.NewSigner(target.cfg, target.credentials)
+		if err != nil {
+			return errors.Wrap(err, "Failed to initialize image signing")
+		}
+		if signer != nil && len(tagsToPush) > 0 {
+			if err := signer.SignImageName(ctx, tagsToPush[0]); err != nil {
+				return errors.Wrap(err, "Failed to sign image")
+			}
+		}
+		return nil
+	})
+}
+
+// retagManifestList puts the manifest list of the temporary image under each of the tags in the registry.
+// Returns false if the temporary image is not a manifest list.
+func (m *retagger) retagManifestList(ctx context.Context, target *retagTarget) (bool, error) {
+	repository := target.cfg.DockerSpec.OutputRepository
+	tagsToPush := target.tags
+	registry := docker.NewRegistryApi(target.cfg.DockerSpec.OutputRegistry, target.credentials)
+	var list *docker.ManifestList
+	err := m.Progress.Run(ctx, target.phase("pull"), func(ctx context.Context) error {
+		var err error
+		list, err = registry.GetManifestList(ctx, repository, target.cfg.DockerSpec.RetagWith)
+		return err
+	})
+	if err != nil || list == nil {
+		return false, err
+	}
+
+	err = m.Progress.Run(ctx, target.phase("push"), func(ctx context.Context) error {
+		for _, tag := range tagsToPush {
+			_, _, reference, err := signing.ParseImageName(tag)
+			if err != nil {
+				return err
+			}
+			logrus.Infof("Push manifest list of %d platforms with tag %s", len(list.Manifests), tag)
+			if _, err := registry.PutManifestList(ctx, repository, reference, list); err != nil {
+				return err
+			}
+		}
+		signer, err := signing.NewSigner(target.cfg, target.credentials)
+		if err != nil {
+			return errors.Wrap(err, "Failed to initialize image signing")
+		}
+		if signer != nil && len(tagsToPush) > 0 {
+			if err := signer.SignImageName(ctx, tagsToPush[0]); err != nil {
+				return errors.Wrap(err, "Failed to sign image")
+			}
+		}
+		return nil
+	})
+	return true, err
+}
+
+// imageVersion is what the temporary image tells about its build
+type imageVersion struct {
+	appVersion    *runtime.AuroraVersion
+	pushExtraTags config.PushExtraTags
+	// The source and build time of the image, for the tag policy
+	source    config.SourceSpec
+	buildTime time.Time
+}
+
+// readVersion finds the version of the temporary image from the environment in its manifest. With a tag policy,
+// the source and build time are read from the labels of the image, so that the policy resolves the same tags
+// as in a normal build of the image.
+func (m *retagger) readVersion(ctx context.Context) (*imageVersion, error) {
 	tag := m.Config.DockerSpec.RetagWith
 	repository := m.Config.DockerSpec.OutputRepository
 
 	logrus.Debug("Get ENV from image manifest")
-	manifestProvider := docker.NewRegistryClient(m.Config.DockerSpec.ExternalDockerRegistry)
+	externalCredentials, err := m.Credentials(m.Config.DockerSpec.ExternalDockerRegistry)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read registry credentials")
+	}
+	manifestProvider := docker.NewRegistryClient(m.Config.DockerSpec.ExternalDockerRegistry,
+		m.Config.RetrySpec.RetryPolicy(), externalCredentials)
 
-	envMap, err := manifestProvider.GetManifestEnvMap(repository, tag)
+	envMap, err := manifestProvider.GetManifestEnvMap(ctx, repository, tag)
 
 	if err != nil {
-		return errors.Wrap(err, "Failed to retag image")
+		return nil, errors.Wrap(err, "Failed to retag image")
 	}
 
 	// Get AURORA_VERSION
 	auroraVersion, ok := envMap[docker.ENV_AURORA_VERSION]
 
 	if !ok {
-		return errors.Errorf("Failed to extract ENV variable %s from temporary image manifest", docker.ENV_AURORA_VERSION)
+		return nil, errors.Errorf("Failed to extract ENV variable %s from temporary image manifest", docker.ENV_AURORA_VERSION)
 	}
 
 	appVersionString, ok := envMap[docker.ENV_APP_VERSION]
 
 	if !ok {
-		return errors.Errorf("Failed to extract ENV variable %s from temporary image manifest", docker.ENV_APP_VERSION)
+		return nil, errors.Errorf("Failed to extract ENV variable %s from temporary image manifest", docker.ENV_APP_VERSION)
 	}
 
 	givenVersionString, snapshot := envMap[docker.ENV_SNAPSHOT_TAG]
@@ -62,71 +358,99 @@ func (m *retagger) Retag() error {
 	extratags, ok := envMap[docker.ENV_PUSH_EXTRA_TAGS]
 
 	if !ok {
-		return errors.Errorf("Failed to extract ENV variable %s from temporary image manifest", docker.ENV_PUSH_EXTRA_TAGS)
+		return nil, errors.Errorf("Failed to extract ENV variable %s from temporary image manifest", docker.ENV_PUSH_EXTRA_TAGS)
 	}
 
-	logrus.Debugf("Extract tag info, auroraVersion=%s, appVersion=%s, extraTags=%s", auroraVersion, appVersion, extratags)
+	pushExtraTags, err := config.ParseExtraTags(extratags)
 
-	provider := docker.NewRegistryClient(m.Config.DockerSpec.ExternalDockerRegistry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse ENV variable %s from temporary image manifest", docker.ENV_PUSH_EXTRA_TAGS)
+	}
 
+	logrus.Debugf("Extract tag info, auroraVersion=%s, appVersion=%s, extraTags=%s", auroraVersion, appVersion, extratags)
+	version := &imageVersion{
+		appVersion:    appVersion,
+		pushExtraTags: pushExtraTags,
+	}
+	if m.Config.DockerSpec.TagPolicy == nil {
+		return version, nil
+	}
+
+	logrus.Debug("Get labels from image config")
+	imageConfig, err := docker.NewRegistryApi(m.Config.DockerSpec.ExternalDockerRegistry, externalCredentials).
+		GetImageConfig(ctx, repository, tag)
 	if err != nil {
-		return errors.Wrap(err, "Unable to get version tags")
+		return nil, errors.Wrap(err, "Failed to read the labels of the temporary image")
 	}
+	version.source = config.SourceSpec{
+		GitUri:    imageConfig.Labels[docker.LABEL_OCI_SOURCE],
+		GitRef:    imageConfig.Labels[docker.LABEL_GIT_REF],
+		GitCommit: imageConfig.Labels[docker.LABEL_OCI_REVISION],
+	}
+	version.buildTime = readBuildTime(imageConfig.Labels[docker.LABEL_OCI_CREATED], envMap[docker.IMAGE_BUILD_TIME])
+	return version, nil
+}
 
-	imageId := runtime.DockerImage{
-		Registry:   m.Config.DockerSpec.OutputRegistry,
-		Repository: m.Config.DockerSpec.OutputRepository,
-		Tag:        m.Config.DockerSpec.RetagWith,
+// readBuildTime parses the created label of the image, or the build time in its environment in images built
+// before the label. The retag time is used if neither is present.
+func readBuildTime(values ...string) time.Time {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		buildTime, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return buildTime
+		}
+		logrus.Debugf("Ignoring build time %s of temporary image: %s", value, err)
+	}
+	logrus.Warn("The build time of the temporary image is unknown, date tags use the time of the retag")
+	return time.Now()
+}
+
+// resolveTags finds the tags of the version in the registry of the target
+func (m *retagger) resolveTags(ctx context.Context, target *retagTarget, version *imageVersion) ([]string, error) {
+	cfg := target.cfg
+	provider := target.provider
+
+	if cfg.DockerSpec.TagPolicy != nil {
+		// The policy resolver reads the tags of the repository itself
+		policyResolver := &tagger.PolicyTagResolver{
+			Overwrite:  cfg.DockerSpec.TagOverwrite,
+			Provider:   provider,
+			Registry:   cfg.DockerSpec.OutputRegistry,
+			Repository: cfg.DockerSpec.OutputRepository,
+			Policy:     cfg.DockerSpec.TagPolicy,
+			Source:     version.source,
+			Now: func() time.Time {
+				return version.buildTime
+			},
+		}
+		return policyResolver.ResolveTags(ctx, version.appVersion, version.pushExtraTags)
 	}
 
 	var repositoryTags []string
 
-	if !m.Config.DockerSpec.TagOverwrite {
+	if !cfg.DockerSpec.TagOverwrite {
 		logrus.Debug("Tags Overwrite diabled, filtering tags")
 
-		rt, err := provider.GetTags(m.Config.DockerSpec.OutputRepository)
+		rt, err := provider.GetTags(ctx, cfg.DockerSpec.OutputRepository)
 
 		if err != nil {
-			return errors.Wrapf(err, "Error in GetTags, repository=%s", m.Config.DockerSpec.OutputRepository)
+			return nil, errors.Wrapf(err, "Error in GetTags, repository=%s", cfg.DockerSpec.OutputRepository)
 
 		}
 		repositoryTags = rt.Tags
 
 	}
 
-	versionTags, err := appVersion.GetApplicationVersionTagsToPush(repositoryTags, config.ParseExtraTags(extratags))
+	versionTags, err := version.appVersion.GetApplicationVersionTagsToPush(repositoryTags, version.pushExtraTags)
 
 	if err != nil {
-		return err
-	}
-
-	tagsToPush := docker.CreateImageNameFromSpecAndTags(versionTags,
-		m.Config.DockerSpec.OutputRegistry,
-		m.Config.DockerSpec.OutputRepository)
-
-	client, err := docker.NewDockerClient()
-	if err != nil {
-		return errors.Wrap(err, "Error initializing Docker")
+		return nil, err
 	}
 
-	//We need to pull to make sure we push the newest image.. We should probably do this directly
-	//on the registry when we get v2 registry!:)
-	client.PullImage(imageId)
-
-	logrus.Debugf("Retagging temporary image, versionTags=%-v", versionTags)
-	for _, tag := range tagsToPush {
-		sourceTag := imageId.GetCompleteDockerTagName()
-		logrus.Infof("Tag image %s with alias %s", sourceTag, tag)
-		err := client.TagImage(sourceTag, tag)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to tag image %s with tag %s", imageId, tag)
-		}
-	}
-	for _, tag := range tagsToPush {
-		err = client.PushImage(tag, m.Credentials)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to push tag %s", tag)
-		}
-	}
-	return nil
+	return docker.CreateImageNameFromSpecAndTags(versionTags,
+		cfg.DockerSpec.OutputRegistry,
+		cfg.DockerSpec.OutputRepository), nil
 }
@@ -0,0 +1,144 @@
+package tagger
+
+import (
+	"context"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultDateFormat = "20060102"
+
+var invalidTagCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// PolicyTagResolver resolves tags from a declarative TagPolicy. Semantic version rules (latest, major,
+// minor and patch) are filtered against the existing tags in the repository as for NormalTagResolver.
+// Channel and static tags are moved like latest, so they are not moved back by an older release.
+// The policy replaces PUSH_EXTRA_TAGS.
+type PolicyTagResolver struct {
+	Registry   string
+	Repository string
+	Overwrite  bool
+	Provider   docker.ImageInfoProvider
+	Policy     *config.TagPolicy
+	Source     config.SourceSpec
+	Now        func() time.Time
+}
+
+func (m *PolicyTagResolver) ResolveTags(ctx context.Context, appVersion *runtime.AuroraVersion, pushExtratags config.PushExtraTags) ([]string, error) {
+	semanticExtraTags := m.Policy.SemanticExtraTags()
+	if pushExtratags != (config.PushExtraTags{}) && pushExtratags != semanticExtraTags {
+		logrus.Infof("Ignoring PUSH_EXTRA_TAGS %s, as the tag policy decides the tags", pushExtratags.ToStringValue())
+	}
+
+	repositoryTags, err := findRepositoryTags(ctx, m.Overwrite, m.Repository, m.Provider)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := findVersionTags(appVersion, repositoryTags, semanticExtraTags)
+	if err != nil {
+		return nil, err
+	}
+	newerRelease, err := appVersion.HasNewerRelease(repositoryTags)
+	if err != nil {
+		return nil, err
+	}
+
+	policyTags, err := m.evaluateRules(appVersion, newerRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range policyTags {
+		if !containsTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	logrus.Debugf("Tag policy resolved tags %v", tags)
+	return docker.CreateImageNameFromSpecAndTags(tags, m.Registry, m.Repository), nil
+}
+
+func (m *PolicyTagResolver) evaluateRules(appVersion *runtime.AuroraVersion, newerRelease bool) ([]string, error) {
+	now := time.Now
+	if m.Now != nil {
+		now = m.Now
+	}
+	tags := make([]string, 0, len(m.Policy.Rules))
+	for _, rule := range m.Policy.Rules {
+		if !rule.Applies(appVersion.Snapshot) {
+			continue
+		}
+		var tag string
+		switch rule.Type {
+		case config.LatestTagRule, config.MajorTagRule, config.MinorTagRule, config.PatchTagRule:
+			// Resolved together with the complete version
+			continue
+		case config.SnapshotTagRule:
+			if appVersion.Snapshot {
+				tag = appVersion.GetGivenVersion()
+			}
+		case config.BranchTagRule:
+			tag = findBranch(appVersion, m.Source)
+		case config.DateTagRule:
+			format := rule.Format
+			if format == "" {
+				format = defaultDateFormat
+			}
+			tag = now().UTC().Format(format)
+		case config.GitShaTagRule:
+			tag = m.Source.ShortCommit()
+		case config.ChannelTagRule, config.StaticTagRule:
+			if newerRelease {
+				logrus.Infof("Tag %s is not moved, as the repository has a newer release than %s", rule.Name,
+					appVersion.GetAppVersion())
+				continue
+			}
+			tag = rule.Name
+		default:
+			return nil, errors.Errorf("Unknown tag rule type %s", rule.Type)
+		}
+		if tag == "" {
+			logrus.Debugf("Tag rule %s did not resolve to a tag", rule.Type)
+			continue
+		}
+		tags = append(tags, sanitizeTag(rule.Prefix+tag))
+	}
+	return tags, nil
+}
+
+// findBranch uses the git ref of the build if present, otherwise the branch part of a snapshot version.
+// e.g. feature-AOS-123-SNAPSHOT -> feature-AOS-123
+func findBranch(appVersion *runtime.AuroraVersion, source config.SourceSpec) string {
+	if branch := source.GitBranch(); branch != "" {
+		return branch
+	}
+	if appVersion.Snapshot {
+		return strings.TrimSuffix(appVersion.GetGivenVersion(), "-SNAPSHOT")
+	}
+	return ""
+}
+
+// A Docker tag may contain lowercase and uppercase letters, digits, underscores, periods and dashes.
+// It may not start with a period or a dash and may contain a maximum of 128 characters.
+func sanitizeTag(tag string) string {
+	tag = invalidTagCharacters.ReplaceAllString(tag, "_")
+	tag = strings.TrimLeft(tag, ".-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return tag
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
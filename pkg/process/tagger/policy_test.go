@@ -0,0 +1,107 @@
+package tagger_test
+
+import (
+	"context"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/config/runtime"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/process/tagger"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var policy = &config.TagPolicy{
+	Rules: []config.TagRule{
+		{Type: config.MajorTagRule},
+		{Type: config.LatestTagRule},
+		{Type: config.ChannelTagRule, Name: "stable", When: config.ReleaseOnly},
+		{Type: config.ChannelTagRule, Name: "edge", When: config.SnapshotOnly},
+		{Type: config.BranchTagRule, When: config.SnapshotOnly},
+		{Type: config.DateTagRule, Prefix: "build-"},
+		{Type: config.GitShaTagRule},
+	},
+}
+
+func TestPolicyTagResolverRelease(t *testing.T) {
+	resolver := newPolicyTagResolver()
+	appVersion := runtime.NewAuroraVersion("2.4.5", false, "2.4.5", runtime.CompleteVersion("2.4.5-b1.11.0-oracle8-1.2.3"))
+
+	tags, err := resolver.ResolveTags(context.Background(), appVersion, config.PushExtraTags{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"registry:5000/aurora/foo:latest",
+		"registry:5000/aurora/foo:2",
+		"registry:5000/aurora/foo:2.4.5-b1.11.0-oracle8-1.2.3",
+		"registry:5000/aurora/foo:stable",
+		"registry:5000/aurora/foo:build-20170910",
+		"registry:5000/aurora/foo:ab543b3",
+	}, tags)
+}
+
+func TestPolicyTagResolverSnapshot(t *testing.T) {
+	resolver := newPolicyTagResolver()
+	appVersion := runtime.NewAuroraVersion("SNAPSHOT-feature_AOS/1-20170910", true, "feature_AOS/1-SNAPSHOT",
+		runtime.CompleteVersion("SNAPSHOT-feature_AOS_1-20170910-b1.11.0-oracle8-1.2.3"))
+
+	tags, err := resolver.ResolveTags(context.Background(), appVersion, config.PushExtraTags{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"registry:5000/aurora/foo:SNAPSHOT-feature_AOS_1-20170910-b1.11.0-oracle8-1.2.3",
+		"registry:5000/aurora/foo:feature_AOS/1-SNAPSHOT",
+		"registry:5000/aurora/foo:edge",
+		"registry:5000/aurora/foo:feature_AOS_1",
+		"registry:5000/aurora/foo:build-20170910",
+		"registry:5000/aurora/foo:ab543b3",
+	}, tags)
+}
+
+func TestPolicyTagResolverDoesNotMoveTagsBackwards(t *testing.T) {
+	resolver := newPolicyTagResolver()
+	resolver.Overwrite = false
+	resolver.Provider = &repositoryTags{tags: []string{"latest", "stable", "2", "2.0", "2.0.0",
+		"2.0.0-b1.11.0-oracle8-1.2.3", "1", "1.2", "1.2.4"}}
+	appVersion := runtime.NewAuroraVersion("1.2.5", false, "1.2.5", runtime.CompleteVersion("1.2.5-b1.11.0-oracle8-1.2.3"))
+
+	tags, err := resolver.ResolveTags(context.Background(), appVersion, config.PushExtraTags{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"registry:5000/aurora/foo:1",
+		"registry:5000/aurora/foo:1.2.5-b1.11.0-oracle8-1.2.3",
+		"registry:5000/aurora/foo:build-20170910",
+		"registry:5000/aurora/foo:ab543b3",
+	}, tags)
+}
+
+type repositoryTags struct {
+	tags []string
+}
+
+func (m *repositoryTags) GetCompleteBaseImageVersion(ctx context.Context, repository string, tag string) (string, error) {
+	return "", nil
+}
+
+func (m *repositoryTags) GetTags(ctx context.Context, repository string) (*docker.TagsAPIResponse, error) {
+	return &docker.TagsAPIResponse{Name: repository, Tags: m.tags}, nil
+}
+
+func (m *repositoryTags) GetManifestEnvMap(ctx context.Context, repository string, tag string) (map[string]string, error) {
+	return nil, nil
+}
+
+func (m *repositoryTags) GetImageDigest(ctx context.Context, repository string, tag string) (string, error) {
+	return "", nil
+}
+
+func newPolicyTagResolver() *tagger.PolicyTagResolver {
+	return &tagger.PolicyTagResolver{
+		Registry:   "registry:5000",
+		Repository: "aurora/foo",
+		Overwrite:  true,
+		Policy:     policy,
+		Source:     config.SourceSpec{GitCommit: "ab543b32de"},
+		Now: func() time.Time {
+			return time.Date(2017, 9, 10, 14, 30, 10, 0, time.UTC)
+		},
+	}
+}
@@ -1,7 +1,9 @@
 package tagger
 
 import (
+	"context"
 	"github.com/Sirupsen/logrus"
+	extVersion "github.com/hashicorp/go-version"
 	"github.com/pkg/errors"
 	"github.com/skatteetaten/architect/pkg/config"
 	"github.com/skatteetaten/architect/pkg/config/runtime"
@@ -9,7 +11,7 @@ import (
 )
 
 type TagResolver interface {
-	ResolveTags(appVersion *runtime.AuroraVersion, pushExtratags config.PushExtraTags) ([]string, error)
+	ResolveTags(ctx context.Context, appVersion *runtime.AuroraVersion, pushExtratags config.PushExtraTags) ([]string, error)
 }
 
 type SingleTagTagResolver struct {
@@ -18,7 +20,7 @@ type SingleTagTagResolver struct {
 	Tag        string
 }
 
-func (m *SingleTagTagResolver) ResolveTags(appVersion *runtime.AuroraVersion, pushExtratags config.PushExtraTags) ([]string, error) {
+func (m *SingleTagTagResolver) ResolveTags(ctx context.Context, appVersion *runtime.AuroraVersion, pushExtratags config.PushExtraTags) ([]string, error) {
 	return docker.CreateImageNameFromSpecAndTags([]string{m.Tag}, m.Registry, m.Repository), nil
 }
 
@@ -29,8 +31,8 @@ type NormalTagResolver struct {
 	Provider   docker.ImageInfoProvider
 }
 
-func (m *NormalTagResolver) ResolveTags(appVersion *runtime.AuroraVersion, pushExtratags config.PushExtraTags) ([]string, error) {
-	tags, err := findCandidateTags(appVersion, m.Overwrite, m.Repository, pushExtratags, m.Provider)
+func (m *NormalTagResolver) ResolveTags(ctx context.Context, appVersion *runtime.AuroraVersion, pushExtratags config.PushExtraTags) ([]string, error) {
+	tags, err := findCandidateTags(ctx, appVersion, m.Overwrite, m.Repository, pushExtratags, m.Provider)
 	if err != nil {
 		return nil, err
 	}
@@ -38,12 +40,12 @@ func (m *NormalTagResolver) ResolveTags(appVersion *runtime.AuroraVersion, pushE
 	return docker.CreateImageNameFromSpecAndTags(tags, m.Registry, m.Repository), nil
 }
 
-func findCandidateTags(appVersion *runtime.AuroraVersion, tagOverwrite bool, outputRepository string,
+func findCandidateTags(ctx context.Context, appVersion *runtime.AuroraVersion, tagOverwrite bool, outputRepository string,
 	pushExtraTags config.PushExtraTags, provider docker.ImageInfoProvider) ([]string, error) {
 	var repositoryTags []string
 	if !tagOverwrite {
 
-		repositoryTags, err := provider.GetTags(outputRepository)
+		repositoryTags, err := provider.GetTags(ctx, outputRepository)
 		logrus.Debug("Tags in repository ", repositoryTags)
 
 		if err != nil {
@@ -51,6 +53,33 @@ func findCandidateTags(appVersion *runtime.AuroraVersion, tagOverwrite bool, out
 		}
 
 	}
+	return findVersionTags(appVersion, repositoryTags, pushExtraTags)
+}
+
+// findRepositoryTags returns the version tags in the repository, which keep an older version from moving the
+// tags of a newer one. Other tags, like latest, are left out, as the comparison stops at the first tag that is
+// not a version. There is nothing to compare with when tags are overwritten.
+func findRepositoryTags(ctx context.Context, tagOverwrite bool, outputRepository string,
+	provider docker.ImageInfoProvider) ([]string, error) {
+	if tagOverwrite {
+		return nil, nil
+	}
+	tags, err := provider.GetTags(ctx, outputRepository)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error in GetTags, repository=%s", outputRepository)
+	}
+	logrus.Debug("Tags in repository ", tags.Tags)
+	versions := make([]string, 0, len(tags.Tags))
+	for _, tag := range tags.Tags {
+		if _, err := extVersion.NewVersion(tag); err == nil {
+			versions = append(versions, tag)
+		}
+	}
+	return versions, nil
+}
+
+func findVersionTags(appVersion *runtime.AuroraVersion, repositoryTags []string,
+	pushExtraTags config.PushExtraTags) ([]string, error) {
 	versionTags, err := appVersion.GetApplicationVersionTagsToPush(repositoryTags, pushExtraTags)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error in FilterVersionTags, app_version=%s, "+
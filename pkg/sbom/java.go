@@ -0,0 +1,153 @@
+package sbom
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Matches the version part of a jar file name, e.g. slf4j-api-1.7.6.jar
+var jarVersionPattern = regexp.MustCompile(`^(.+?)-([0-9][^-]*(-[A-Za-z0-9.]+)*)$`)
+
+// FromJars lists the jar files in the library path of a Java application. The GAV is read from the
+// pom.properties embedded by Maven. Jars without pom.properties are named from the file name.
+func FromJars(libPath string) ([]Component, error) {
+	components := make([]Component, 0)
+	err := filepath.Walk(libPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".jar") {
+			return nil
+		}
+		component, err := componentFromJar(p)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read %s", info.Name())
+		}
+		components = append(components, *component)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list jars in %s", libPath)
+	}
+	return components, nil
+}
+
+func componentFromJar(jarPath string) (*Component, error) {
+	checksum, err := sha256File(jarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	component, err := readPomProperties(jarPath)
+	if err != nil {
+		return nil, err
+	}
+	if component == nil {
+		logrus.Debugf("No pom.properties in %s, using the file name", jarPath)
+		component = componentFromFileName(filepath.Base(jarPath))
+	}
+	component.Hashes = []Hash{{Alg: "SHA-256", Content: checksum}}
+	return component, nil
+}
+
+// A shaded jar may contain pom.properties for several artifacts. We prefer the one matching the file name.
+func readPomProperties(jarPath string) (*Component, error) {
+	reader, err := zip.OpenReader(jarPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to open jar")
+	}
+	defer reader.Close()
+
+	var found *Component
+	for _, file := range reader.File {
+		if !strings.HasPrefix(file.Name, "META-INF/maven/") || path.Base(file.Name) != "pom.properties" {
+			continue
+		}
+		properties, err := readProperties(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read %s", file.Name)
+		}
+		component := &Component{
+			Type:    LibraryComponent,
+			Group:   properties["groupId"],
+			Name:    properties["artifactId"],
+			Version: properties["version"],
+		}
+		if component.Name == "" {
+			continue
+		}
+		component.Purl = mavenPurl(component.Group, component.Name, component.Version)
+		if strings.HasPrefix(filepath.Base(jarPath), component.Name+"-") {
+			return component, nil
+		}
+		if found == nil {
+			found = component
+		}
+	}
+	return found, nil
+}
+
+func readProperties(file *zip.File) (map[string]string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	properties := make(map[string]string)
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if i := strings.IndexAny(line, "=:"); i > 0 {
+			properties[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return properties, scanner.Err()
+}
+
+func componentFromFileName(fileName string) *Component {
+	name := strings.TrimSuffix(fileName, ".jar")
+	component := &Component{
+		Type: LibraryComponent,
+		Name: name,
+	}
+	if match := jarVersionPattern.FindStringSubmatch(name); match != nil {
+		component.Name = match[1]
+		component.Version = match[2]
+	}
+	return component
+}
+
+func mavenPurl(group string, name string, version string) string {
+	purl := "pkg:maven/" + group + "/" + name
+	if version != "" {
+		purl += "@" + version
+	}
+	return purl
+}
+
+func sha256File(p string) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to open file")
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", errors.Wrap(err, "Failed to compute checksum")
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,164 @@
+package sbom
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type packageLock struct {
+	LockfileVersion int                         `json:"lockfileVersion"`
+	Packages        map[string]lockedPackage    `json:"packages"`
+	Dependencies    map[string]lockedDependency `json:"dependencies"`
+}
+
+// lockedPackage is an entry in "packages" used by lockfile version 2 and 3
+type lockedPackage struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Integrity string `json:"integrity"`
+	Link      bool   `json:"link"`
+}
+
+// lockedDependency is an entry in the "dependencies" tree used by lockfile version 1
+type lockedDependency struct {
+	Version      string                      `json:"version"`
+	Integrity    string                      `json:"integrity"`
+	Dependencies map[string]lockedDependency `json:"dependencies"`
+}
+
+type packageJson struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// FromPackageLock lists the packages in a package-lock.json. Both the "packages" map of lockfile
+// version 2 and 3 and the nested "dependencies" of version 1 are supported.
+func FromPackageLock(data []byte) ([]Component, error) {
+	lock := packageLock{}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal package-lock.json")
+	}
+
+	components := make([]Component, 0)
+	seen := make(map[string]bool)
+	add := func(name string, version string, integrity string) {
+		if name == "" || seen[name+"@"+version] {
+			return
+		}
+		seen[name+"@"+version] = true
+		components = append(components, npmComponent(name, version, integrity))
+	}
+
+	if len(lock.Packages) > 0 {
+		for key, pkg := range lock.Packages {
+			// The root project has the key "" and is not a dependency
+			if key == "" || pkg.Link {
+				continue
+			}
+			// Workspace packages are part of the project itself
+			i := strings.LastIndex(key, "node_modules/")
+			if i < 0 {
+				continue
+			}
+			name := pkg.Name
+			if name == "" {
+				name = key[i+len("node_modules/"):]
+			}
+			add(name, pkg.Version, pkg.Integrity)
+		}
+		return components, nil
+	}
+
+	var walk func(map[string]lockedDependency)
+	walk = func(dependencies map[string]lockedDependency) {
+		for name, dependency := range dependencies {
+			add(name, dependency.Version, dependency.Integrity)
+			walk(dependency.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return components, nil
+}
+
+// FromNodeModules lists the packages installed in a node_modules folder. It is used when the
+// deliverable does not contain a package-lock.json.
+func FromNodeModules(nodeModules string) ([]Component, error) {
+	components := make([]Component, 0)
+	err := filepath.Walk(nodeModules, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "package.json" {
+			return nil
+		}
+		// Only node_modules/<name>/package.json and node_modules/@<scope>/<name>/package.json describe a package
+		packageDir := filepath.Dir(p)
+		parent := filepath.Dir(packageDir)
+		if strings.HasPrefix(filepath.Base(parent), "@") {
+			parent = filepath.Dir(parent)
+		}
+		if filepath.Base(parent) != "node_modules" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		pkg := packageJson{}
+		if err := json.Unmarshal(data, &pkg); err != nil || pkg.Name == "" {
+			// Some packages include test fixtures named package.json
+			return nil
+		}
+		components = append(components, npmComponent(pkg.Name, pkg.Version, ""))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list packages in %s", nodeModules)
+	}
+	return components, nil
+}
+
+func npmComponent(name string, version string, integrity string) Component {
+	component := Component{
+		Type:    LibraryComponent,
+		Name:    name,
+		Version: version,
+	}
+	if i := strings.Index(name, "/"); strings.HasPrefix(name, "@") && i > 0 {
+		component.Group = name[:i]
+		component.Name = name[i+1:]
+	}
+	purl := "pkg:npm/" + strings.Replace(name, "@", "%40", 1)
+	if version != "" {
+		purl += "@" + version
+	}
+	component.Purl = purl
+	if hash := integrityHash(integrity); hash != nil {
+		component.Hashes = []Hash{*hash}
+	}
+	return component
+}
+
+// The integrity field is a subresource integrity string, e.g. sha512-<base64>
+func integrityHash(integrity string) *Hash {
+	parts := strings.SplitN(integrity, "-", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	algorithms := map[string]string{"sha1": "SHA-1", "sha256": "SHA-256", "sha512": "SHA-512"}
+	alg, ok := algorithms[parts[0]]
+	if !ok {
+		return nil
+	}
+	content, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	return &Hash{Alg: alg, Content: hex.EncodeToString(content)}
+}
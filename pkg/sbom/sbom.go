@@ -0,0 +1,101 @@
+package sbom
+
+import (
+	"encoding/json"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/util"
+	"io"
+	"sort"
+)
+
+// The SBOM is written in the CycloneDX JSON format, see https://cyclonedx.org/docs/1.4/json/
+const (
+	BomFormat   = "CycloneDX"
+	SpecVersion = "1.4"
+)
+
+// The path of the SBOM in Node.js images. Java images have it in $HOME/architect
+const ImagePath = "/u01/architect/sbom.json"
+
+const (
+	ApplicationComponent = "application"
+	LibraryComponent     = "library"
+)
+
+type Bom struct {
+	BomFormat   string      `json:"bomFormat"`
+	SpecVersion string      `json:"specVersion"`
+	Version     int         `json:"version"`
+	Metadata    Metadata    `json:"metadata"`
+	Components  []Component `json:"components"`
+}
+
+type Metadata struct {
+	Timestamp string    `json:"timestamp,omitempty"`
+	Tools     []Tool    `json:"tools,omitempty"`
+	Component Component `json:"component"`
+}
+
+type Tool struct {
+	Name string `json:"name"`
+}
+
+type Component struct {
+	Type    string `json:"type"`
+	Group   string `json:"group,omitempty"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Purl    string `json:"purl,omitempty"`
+	Hashes  []Hash `json:"hashes,omitempty"`
+}
+
+type Hash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// NewBom creates a bill of materials for the application. The components are sorted by name
+// so that the output is stable between builds of the same deliverable.
+func NewBom(application Component, components []Component, timestamp string) *Bom {
+	sorted := make([]Component, len(components))
+	copy(sorted, components)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Group != sorted[j].Group {
+			return sorted[i].Group < sorted[j].Group
+		}
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Version < sorted[j].Version
+	})
+	return &Bom{
+		BomFormat:   BomFormat,
+		SpecVersion: SpecVersion,
+		Version:     1,
+		Metadata: Metadata{
+			Timestamp: timestamp,
+			Tools:     []Tool{{Name: "architect"}},
+			Component: application,
+		},
+		Components: sorted,
+	}
+}
+
+// NewApplicationComponent describes the application the bill of materials is made for
+func NewApplicationComponent(gav config.MavenGav, appVersion string) Component {
+	return Component{
+		Type:    ApplicationComponent,
+		Group:   gav.GroupId,
+		Name:    gav.ArtifactId,
+		Version: appVersion,
+		Purl:    mavenPurl(gav.GroupId, gav.ArtifactId, appVersion),
+	}
+}
+
+func NewBomWriter(bom *Bom) util.WriterFunc {
+	return func(writer io.Writer) error {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(bom)
+	}
+}
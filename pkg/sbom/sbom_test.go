@@ -0,0 +1,152 @@
+package sbom_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/sbom"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const packageLockV1 = `{
+  "name": "app",
+  "lockfileVersion": 1,
+  "dependencies": {
+    "express": {
+      "version": "4.15.2",
+      "integrity": "sha1-rxB/e2a5bbUzqAYfjjprzgdHB2c=",
+      "dependencies": {
+        "debug": { "version": "2.6.1" }
+      }
+    },
+    "@angular/core": { "version": "4.0.0" }
+  }
+}`
+
+const packageLockV2 = `{
+  "name": "app",
+  "lockfileVersion": 2,
+  "packages": {
+    "": { "name": "app", "version": "1.0.0" },
+    "node_modules/express": { "version": "4.15.2" },
+    "node_modules/express/node_modules/debug": { "version": "2.6.1" },
+    "node_modules/@angular/core": { "version": "4.0.0" },
+    "packages/local": { "version": "1.0.0" }
+  },
+  "dependencies": {
+    "express": { "version": "4.15.2" }
+  }
+}`
+
+func TestFromJars(t *testing.T) {
+	libPath, err := ioutil.TempDir("", "sbom")
+	assert.NoError(t, err)
+	defer os.RemoveAll(libPath)
+
+	writeJar(t, filepath.Join(libPath, "slf4j-api-1.7.6.jar"), map[string]string{
+		"META-INF/maven/org.slf4j/slf4j-api/pom.properties": "#Generated by Maven\nversion=1.7.6\ngroupId=org.slf4j\nartifactId=slf4j-api\n",
+	})
+	writeJar(t, filepath.Join(libPath, "minarch-1.2.22.jar"), map[string]string{
+		"ske/aurora/Main.class": "",
+	})
+
+	components, err := sbom.FromJars(libPath)
+	assert.NoError(t, err)
+	assert.Len(t, components, 2)
+
+	byName := make(map[string]sbom.Component)
+	for _, c := range components {
+		byName[c.Name] = c
+	}
+	assert.Equal(t, "org.slf4j", byName["slf4j-api"].Group)
+	assert.Equal(t, "1.7.6", byName["slf4j-api"].Version)
+	assert.Equal(t, "pkg:maven/org.slf4j/slf4j-api@1.7.6", byName["slf4j-api"].Purl)
+	assert.Equal(t, "SHA-256", byName["slf4j-api"].Hashes[0].Alg)
+	assert.Len(t, byName["slf4j-api"].Hashes[0].Content, 64)
+
+	assert.Equal(t, "", byName["minarch"].Group)
+	assert.Equal(t, "1.2.22", byName["minarch"].Version)
+}
+
+func TestFromPackageLock(t *testing.T) {
+	for _, lockfile := range []string{packageLockV1, packageLockV2} {
+		components, err := sbom.FromPackageLock([]byte(lockfile))
+		assert.NoError(t, err)
+		assert.Len(t, components, 3)
+
+		purls := make([]string, 0)
+		for _, c := range components {
+			purls = append(purls, c.Purl)
+		}
+		assert.Contains(t, purls, "pkg:npm/express@4.15.2")
+		assert.Contains(t, purls, "pkg:npm/debug@2.6.1")
+		assert.Contains(t, purls, "pkg:npm/%40angular/core@4.0.0")
+	}
+}
+
+func TestFromPackageLockIntegrity(t *testing.T) {
+	components, err := sbom.FromPackageLock([]byte(packageLockV1))
+	assert.NoError(t, err)
+	for _, c := range components {
+		if c.Name == "express" {
+			assert.Equal(t, []sbom.Hash{{Alg: "SHA-1", Content: "af107f7b66b96db533a8061f8e3a6bce07470767"}}, c.Hashes)
+		}
+	}
+}
+
+func TestFromNodeModules(t *testing.T) {
+	packageDirectory, err := ioutil.TempDir("", "sbom")
+	assert.NoError(t, err)
+	defer os.RemoveAll(packageDirectory)
+	nodeModules := filepath.Join(packageDirectory, "node_modules")
+
+	writeFile(t, filepath.Join(nodeModules, "express", "package.json"), `{"name": "express", "version": "4.15.2"}`)
+	writeFile(t, filepath.Join(nodeModules, "@angular", "core", "package.json"), `{"name": "@angular/core", "version": "4.0.0"}`)
+	writeFile(t, filepath.Join(nodeModules, "express", "test", "package.json"), `{"name": "fixture"}`)
+
+	components, err := sbom.FromNodeModules(nodeModules)
+	assert.NoError(t, err)
+	assert.Len(t, components, 2)
+}
+
+func TestBomWriter(t *testing.T) {
+	gav := config.MavenGav{GroupId: "ske.aurora", ArtifactId: "minarch", Version: "1.2.22"}
+	components := []sbom.Component{
+		{Type: sbom.LibraryComponent, Name: "slf4j-api", Group: "org.slf4j", Version: "1.7.6"},
+		{Type: sbom.LibraryComponent, Name: "log4j-over-slf4j", Group: "org.slf4j", Version: "1.7.6"},
+	}
+	bom := sbom.NewBom(sbom.NewApplicationComponent(gav, "1.2.22"), components, "2017-09-07T12:00:00Z")
+
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, sbom.NewBomWriter(bom)(buffer))
+
+	result := sbom.Bom{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &result))
+	assert.Equal(t, "CycloneDX", result.BomFormat)
+	assert.Equal(t, "pkg:maven/ske.aurora/minarch@1.2.22", result.Metadata.Component.Purl)
+	assert.Equal(t, "log4j-over-slf4j", result.Components[0].Name)
+	assert.Equal(t, "slf4j-api", result.Components[1].Name)
+}
+
+func writeJar(t *testing.T, path string, files map[string]string) {
+	buffer := &bytes.Buffer{}
+	writer := zip.NewWriter(buffer)
+	for name, content := range files {
+		f, err := writer.Create(name)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	writeFile(t, path, buffer.String())
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
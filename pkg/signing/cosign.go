@@ -0,0 +1,246 @@
+package signing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"math/big"
+	"strings"
+)
+
+// Signatures are stored as cosign stores them, so that they can be verified with cosign verify --key.
+// The signature of an image with digest sha256:<hex> is an OCI manifest tagged sha256-<hex>.sig in the same
+// repository. Each layer is a signed payload, with the signature in an annotation.
+// See https://github.com/sigstore/cosign/blob/main/specs/SIGNATURE_SPEC.md
+const (
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	SignatureAnnotation    = "dev.cosignproject.cosign/signature"
+	ociConfigMediaType     = "application/vnd.oci.image.config.v1+json"
+	signatureType          = "cosign container image signature"
+)
+
+// ArtifactRegistry is the part of the registry API needed to store and read signatures
+type ArtifactRegistry interface {
+	GetManifestDigest(ctx context.Context, repository string, reference string) (string, error)
+	GetImageManifest(ctx context.Context, repository string, reference string) (*docker.ImageManifest, error)
+	PutImageManifest(ctx context.Context, repository string, reference string, manifest *docker.ImageManifest) (string, error)
+	GetBlob(ctx context.Context, repository string, digest string) ([]byte, error)
+	UploadBlob(ctx context.Context, repository string, mediaType string, content []byte) (*docker.Descriptor, error)
+}
+
+// Payload is the signed content, in the simple signing format
+type Payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]string `json:"optional"`
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// SignatureTag returns the tag of the signature manifest for an image digest
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+func NewPayload(dockerReference string, digest string) ([]byte, error) {
+	payload := Payload{}
+	payload.Critical.Identity.DockerReference = dockerReference
+	payload.Critical.Image.DockerManifestDigest = digest
+	payload.Critical.Type = signatureType
+	return json.Marshal(payload)
+}
+
+type Signer struct {
+	Key      *ecdsa.PrivateKey
+	Registry ArtifactRegistry
+}
+
+// SignImage signs the manifest digest of an image in the registry. The image is not signed again if
+// it already has a valid signature with the same key.
+func (m *Signer) SignImage(ctx context.Context, registry string, repository string, digest string) error {
+	signatureTag := SignatureTag(digest)
+	manifest, err := m.Registry.GetImageManifest(ctx, repository, signatureTag)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get existing signatures")
+	}
+	if manifest == nil {
+		manifest = &docker.ImageManifest{
+			SchemaVersion: 2,
+			MediaType:     docker.MediaTypeOCIManifest,
+		}
+	}
+
+	dockerReference := registry + "/" + repository
+	verifier := &Verifier{Key: &m.Key.PublicKey, Registry: m.Registry}
+	for _, layer := range manifest.Layers {
+		if verifier.verifyLayer(ctx, repository, layer, dockerReference, digest) == nil {
+			logrus.Infof("Image %s@%s is already signed", dockerReference, digest)
+			return nil
+		}
+	}
+
+	payload, err := NewPayload(dockerReference, digest)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create signature payload")
+	}
+	signature, err := sign(m.Key, payload)
+	if err != nil {
+		return err
+	}
+
+	layer, err := m.Registry.UploadBlob(ctx, repository, SimpleSigningMediaType, payload)
+	if err != nil {
+		return errors.Wrap(err, "Failed to upload signature payload")
+	}
+	layer.Annotations = map[string]string{SignatureAnnotation: signature}
+	manifest.Layers = append(manifest.Layers, *layer)
+
+	config, err := newSignatureConfig(manifest.Layers)
+	if err != nil {
+		return err
+	}
+	configDescriptor, err := m.Registry.UploadBlob(ctx, repository, ociConfigMediaType, config)
+	if err != nil {
+		return errors.Wrap(err, "Failed to upload signature config")
+	}
+	manifest.Config = *configDescriptor
+
+	if _, err := m.Registry.PutImageManifest(ctx, repository, signatureTag, manifest); err != nil {
+		return errors.Wrap(err, "Failed to push signature")
+	}
+	logrus.Infof("Signed %s@%s", dockerReference, digest)
+	return nil
+}
+
+type Verifier struct {
+	Key      *ecdsa.PublicKey
+	Registry ArtifactRegistry
+}
+
+// VerifyImage checks that the image has a signature made with the key. The reference is a tag or a digest.
+// Returns the verified digest.
+func (m *Verifier) VerifyImage(ctx context.Context, registry string, repository string, reference string) (string, error) {
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		var err error
+		digest, err = m.Registry.GetManifestDigest(ctx, repository, reference)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	manifest, err := m.Registry.GetImageManifest(ctx, repository, SignatureTag(digest))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get signatures")
+	}
+	if manifest == nil {
+		return "", errors.Errorf("No signatures found for %s/%s@%s", registry, repository, digest)
+	}
+
+	dockerReference := registry + "/" + repository
+	for _, layer := range manifest.Layers {
+		err := m.verifyLayer(ctx, repository, layer, dockerReference, digest)
+		if err == nil {
+			return digest, nil
+		}
+		logrus.Debugf("Signature %s is not valid: %s", layer.Digest, err)
+	}
+	return "", errors.Errorf("No valid signature for %s@%s with the given key", dockerReference, digest)
+}
+
+func (m *Verifier) verifyLayer(ctx context.Context, repository string, layer docker.Descriptor, dockerReference string, digest string) error {
+	if layer.MediaType != SimpleSigningMediaType {
+		return errors.Errorf("Unexpected media type %s", layer.MediaType)
+	}
+	signature, ok := layer.Annotations[SignatureAnnotation]
+	if !ok {
+		return errors.New("No signature annotation")
+	}
+	payload, err := m.Registry.GetBlob(ctx, repository, layer.Digest)
+	if err != nil {
+		return err
+	}
+	if err := verify(m.Key, payload, signature); err != nil {
+		return err
+	}
+
+	p := Payload{}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return errors.Wrap(err, "Failed to unmarshal signature payload")
+	}
+	if p.Critical.Image.DockerManifestDigest != digest {
+		return errors.Errorf("Signature is for digest %s", p.Critical.Image.DockerManifestDigest)
+	}
+	if p.Critical.Identity.DockerReference != dockerReference {
+		return errors.Errorf("Signature is for image %s", p.Critical.Identity.DockerReference)
+	}
+	return nil
+}
+
+func sign(key *ecdsa.PrivateKey, payload []byte) (string, error) {
+	hash := sha256.Sum256(payload)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to sign payload")
+	}
+	signature, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to encode signature")
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+func verify(key *ecdsa.PublicKey, payload []byte, signature string) error {
+	der, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "Failed to decode signature")
+	}
+	s := ecdsaSignature{}
+	if _, err := asn1.Unmarshal(der, &s); err != nil {
+		return errors.Wrap(err, "Failed to parse signature")
+	}
+	hash := sha256.Sum256(payload)
+	if !ecdsa.Verify(key, hash[:], s.R, s.S) {
+		return errors.New("Signature does not match key")
+	}
+	return nil
+}
+
+// The config of a signature manifest is an empty image with the payloads as layers
+func newSignatureConfig(layers []docker.Descriptor) ([]byte, error) {
+	diffIds := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		diffIds = append(diffIds, layer.Digest)
+	}
+	config := map[string]interface{}{
+		"architecture": "",
+		"os":           "",
+		"created":      "0001-01-01T00:00:00Z",
+		"config":       map[string]interface{}{},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": diffIds,
+		},
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal signature config")
+	}
+	return content, nil
+}
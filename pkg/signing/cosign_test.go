@@ -0,0 +1,170 @@
+package signing_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"github.com/skatteetaten/architect/pkg/signing"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const imageManifest = `{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json"}`
+
+var manifestPath = regexp.MustCompile(`^/v2/(.+)/manifests/([^/]+)$`)
+var blobPath = regexp.MustCompile(`^/v2/(.+)/blobs/(sha256:[a-f0-9]+)$`)
+var uploadPath = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/(.*)$`)
+
+// A minimal in-memory registry with token authentication
+type testRegistry struct {
+	sync.Mutex
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	server    *httptest.Server
+}
+
+func newTestRegistry() *testRegistry {
+	registry := &testRegistry{
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+	registry.server = httptest.NewServer(http.HandlerFunc(registry.handle))
+	return registry
+}
+
+func (m *testRegistry) handle(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if r.URL.Path == "/token" {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "aurora" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"token": "t0ken"}`))
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer t0ken" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+m.server.URL+`/token",service="registry",scope="repository:aurora/app:pull,push"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if match := manifestPath.FindStringSubmatch(r.URL.Path); match != nil {
+		key := match[1] + ":" + match[2]
+		switch r.Method {
+		case "PUT":
+			m.manifests[key] = body
+			m.manifests[match[1]+":"+docker.Digest(body)] = body
+			w.WriteHeader(http.StatusCreated)
+		default:
+			content, ok := m.manifests[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", docker.Digest(content))
+			w.Write(content)
+		}
+	} else if match := uploadPath.FindStringSubmatch(r.URL.Path); match != nil {
+		if r.Method == "POST" {
+			w.Header().Set("Location", "/v2/"+match[1]+"/blobs/uploads/1234?state=abc")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		m.blobs[r.URL.Query().Get("digest")] = body
+		w.WriteHeader(http.StatusCreated)
+	} else if match := blobPath.FindStringSubmatch(r.URL.Path); match != nil {
+		content, ok := m.blobs[match[2]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(content)
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (m *testRegistry) address() string {
+	return strings.TrimPrefix(m.server.URL, "http://")
+}
+
+func TestSignAndVerify(t *testing.T) {
+	registry := newTestRegistry()
+	defer registry.server.Close()
+	registry.manifests["aurora/app:1.2.3"] = []byte(imageManifest)
+	digest := docker.Digest([]byte(imageManifest))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	credentials := &docker.RegistryCredentials{Username: "aurora", Password: "secret"}
+
+	signer := &signing.Signer{
+		Key:      key,
+		Registry: docker.NewRegistryApi(registry.server.URL, credentials),
+	}
+	err = signer.SignImageName(context.Background(), registry.address()+"/aurora/app:1.2.3")
+	assert.NoError(t, err)
+	assert.Contains(t, registry.manifests, "aurora/app:"+signing.SignatureTag(digest))
+
+	// Signing again with the same key should not add another signature
+	err = signer.SignImageName(context.Background(), registry.address()+"/aurora/app:1.2.3")
+	assert.NoError(t, err)
+	manifest, err := signer.Registry.GetImageManifest(context.Background(), "aurora/app", signing.SignatureTag(digest))
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Layers, 1)
+	assert.Equal(t, signing.SimpleSigningMediaType, manifest.Layers[0].MediaType)
+
+	verifier := &signing.Verifier{
+		Key:      &key.PublicKey,
+		Registry: docker.NewRegistryApi(registry.server.URL, credentials),
+	}
+	verified, err := verifier.VerifyImage(context.Background(), registry.address(), "aurora/app", "1.2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, digest, verified)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	verifier.Key = &otherKey.PublicKey
+	_, err = verifier.VerifyImage(context.Background(), registry.address(), "aurora/app", "1.2.3")
+	assert.Error(t, err)
+}
+
+func TestVerifyUnsignedImage(t *testing.T) {
+	registry := newTestRegistry()
+	defer registry.server.Close()
+	registry.manifests["aurora/app:1.2.3"] = []byte(imageManifest)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	verifier := &signing.Verifier{
+		Key:      &key.PublicKey,
+		Registry: docker.NewRegistryApi(registry.server.URL, &docker.RegistryCredentials{Username: "aurora", Password: "secret"}),
+	}
+	_, err = verifier.VerifyImage(context.Background(), registry.address(), "aurora/app", "1.2.3")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "No signatures found")
+}
+
+func TestParseImageName(t *testing.T) {
+	registry, repository, reference, err := signing.ParseImageName("docker-registry.aurora.sits.no:5000/aurora/app:1.2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, "docker-registry.aurora.sits.no:5000", registry)
+	assert.Equal(t, "aurora/app", repository)
+	assert.Equal(t, "1.2.3", reference)
+
+	_, _, reference, err = signing.ParseImageName("docker-registry.aurora.sits.no:5000/aurora/app@sha256:abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:abc", reference)
+}
@@ -0,0 +1,138 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+)
+
+// PEM block types of keys created by cosign generate-key-pair
+const (
+	cosignPrivateKeyType   = "ENCRYPTED COSIGN PRIVATE KEY"
+	sigstorePrivateKeyType = "ENCRYPTED SIGSTORE PRIVATE KEY"
+)
+
+// The encrypted private key format used by cosign, see
+// https://github.com/secure-systems-lab/go-securesystemslib/tree/main/encrypted
+type encryptedKey struct {
+	Kdf struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ReadPrivateKeyFile reads an ECDSA private key. Both encrypted cosign keys and unencrypted PKCS #8 or
+// SEC 1 keys are supported. The password is only used for cosign keys.
+func ReadPrivateKeyFile(path string, password []byte) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read signing key %s", path)
+	}
+	return ParsePrivateKey(data, password)
+}
+
+func ParsePrivateKey(data []byte, password []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("Signing key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case cosignPrivateKeyType, sigstorePrivateKeyType:
+		der, err := decrypt(block.Bytes, password)
+		if err != nil {
+			return nil, err
+		}
+		return parsePKCS8(der)
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to parse EC private key")
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		return parsePKCS8(block.Bytes)
+	default:
+		return nil, errors.Errorf("Unsupported signing key type %s", block.Type)
+	}
+}
+
+func parsePKCS8(der []byte) (*ecdsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse private key")
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("Signing key must be an ECDSA key, was %T", key)
+	}
+	return ecdsaKey, nil
+}
+
+func decrypt(data []byte, password []byte) ([]byte, error) {
+	key := encryptedKey{}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal encrypted signing key")
+	}
+	if key.Kdf.Name != "scrypt" || key.Cipher.Name != "nacl/secretbox" {
+		return nil, errors.Errorf("Unsupported key encryption %s/%s", key.Kdf.Name, key.Cipher.Name)
+	}
+	if len(key.Cipher.Nonce) != 24 {
+		return nil, errors.New("Invalid nonce in encrypted signing key")
+	}
+
+	secret, err := scrypt.Key(password, key.Kdf.Salt, key.Kdf.Params.N, key.Kdf.Params.R, key.Kdf.Params.P, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to derive key from password")
+	}
+	var nonce [24]byte
+	var secretKey [32]byte
+	copy(nonce[:], key.Cipher.Nonce)
+	copy(secretKey[:], secret)
+
+	der, ok := secretbox.Open(nil, key.Ciphertext, &nonce, &secretKey)
+	if !ok {
+		return nil, errors.New("Failed to decrypt signing key. Wrong password?")
+	}
+	return der, nil
+}
+
+// ReadPublicKeyFile reads a PEM encoded ECDSA public key, as created by cosign generate-key-pair
+func ReadPublicKeyFile(path string) (*ecdsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read public key %s", path)
+	}
+	return ParsePublicKey(data)
+}
+
+func ParsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("Public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse public key")
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("Public key must be an ECDSA key, was %T", key)
+	}
+	return ecdsaKey, nil
+}
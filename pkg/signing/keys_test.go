@@ -0,0 +1,71 @@
+package signing_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/skatteetaten/architect/pkg/signing"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"testing"
+)
+
+func TestParseEncryptedCosignKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	// Encrypt the key the same way as cosign generate-key-pair
+	salt := make([]byte, 32)
+	var nonce [24]byte
+	rand.Read(salt)
+	rand.Read(nonce[:])
+	secret, err := scrypt.Key([]byte("hemmelig"), salt, 32768, 8, 1, 32)
+	assert.NoError(t, err)
+	var secretKey [32]byte
+	copy(secretKey[:], secret)
+
+	encrypted, err := json.Marshal(map[string]interface{}{
+		"kdf": map[string]interface{}{
+			"name":   "scrypt",
+			"params": map[string]int{"N": 32768, "r": 8, "p": 1},
+			"salt":   salt,
+		},
+		"cipher":     map[string]interface{}{"name": "nacl/secretbox", "nonce": nonce[:]},
+		"ciphertext": secretbox.Seal(nil, der, &nonce, &secretKey),
+	})
+	assert.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED COSIGN PRIVATE KEY", Bytes: encrypted})
+
+	parsed, err := signing.ParsePrivateKey(data, []byte("hemmelig"))
+	assert.NoError(t, err)
+	assert.Equal(t, key.D, parsed.D)
+
+	_, err = signing.ParsePrivateKey(data, []byte("feil"))
+	assert.Error(t, err)
+}
+
+func TestParseUnencryptedKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	sec1, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	parsed, err := signing.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, key.D, parsed.D)
+
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	parsedPublic, err := signing.ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	assert.NoError(t, err)
+	assert.Equal(t, key.PublicKey.X, parsedPublic.X)
+
+	_, err = signing.ParsePrivateKey([]byte("not a key"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package signing
+
+import (
+	"context"
+	"github.com/docker/docker/reference"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/docker"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// NewSigner creates a signer for the output registry of the build, or nil if signing is not configured
+func NewSigner(cfg *config.Config, credentials *docker.RegistryCredentials) (*Signer, error) {
+	spec := cfg.SigningSpec
+	if spec.KeyFile == "" {
+		return nil, nil
+	}
+
+	password := []byte(os.Getenv("COSIGN_PASSWORD"))
+	if spec.PasswordFile != "" {
+		content, err := ioutil.ReadFile(spec.PasswordFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read signing key password %s", spec.PasswordFile)
+		}
+		password = []byte(strings.TrimRight(string(content), "\r\n"))
+	}
+
+	key, err := ReadPrivateKeyFile(spec.KeyFile, password)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{
+		Key:      key,
+		Registry: docker.NewRegistryApi(cfg.DockerSpec.OutputRegistry, credentials),
+	}, nil
+}
+
+// SignImageName signs the image a pushed tag points to, e.g. registry:5000/aurora/app:1.2.3
+func (m *Signer) SignImageName(ctx context.Context, imageName string) error {
+	registry, repository, tag, err := ParseImageName(imageName)
+	if err != nil {
+		return err
+	}
+	digest, err := m.Registry.GetManifestDigest(ctx, repository, tag)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to find digest of %s", imageName)
+	}
+	return m.SignImage(ctx, registry, repository, digest)
+}
+
+// ParseImageName splits an image name into registry, repository and tag or digest
+func ParseImageName(imageName string) (string, string, string, error) {
+	name := imageName
+	digest := ""
+	if i := strings.Index(imageName, "@"); i >= 0 {
+		name = imageName[:i]
+		digest = imageName[i+1:]
+	}
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		return "", "", "", errors.Wrapf(err, "Invalid image name %s", imageName)
+	}
+	if digest != "" {
+		return named.Hostname(), named.RemoteName(), digest, nil
+	}
+	if tagged, ok := named.(reference.NamedTagged); ok {
+		return named.Hostname(), named.RemoteName(), tagged.Tag(), nil
+	}
+	return named.Hostname(), named.RemoteName(), "latest", nil
+}
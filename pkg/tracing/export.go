@@ -0,0 +1,163 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// Marshal encodes the finished spans as an OTLP ExportTraceServiceRequest in JSON
+func (m *Tracer) Marshal() ([]byte, error) {
+	spans := make([]otlpSpan, 0)
+	for _, span := range m.Spans() {
+		spans = append(spans, otlpSpan{
+			TraceId:           span.TraceId,
+			SpanId:            span.SpanId,
+			ParentSpanId:      span.ParentSpanId,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: unixNano(span.Start),
+			EndTimeUnixNano:   unixNano(span.End),
+			Attributes:        attributes(span.Attributes),
+			Status:            otlpStatus{Code: span.Status, Message: span.Message},
+		})
+	}
+	traces := otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: attributes(m.Resource)},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: ServiceName},
+				Spans: spans,
+			}},
+		}},
+	}
+	return json.Marshal(traces)
+}
+
+// Export sends the spans to the OTLP endpoint and/or writes them to a file. Tracing is not allowed to
+// fail the build, so errors are only logged.
+func (m *Tracer) Export(spec config.TracingSpec) {
+	if m == nil {
+		return
+	}
+	content, err := m.Marshal()
+	if err != nil {
+		logrus.Warnf("Failed to marshal traces: %s", err)
+		return
+	}
+	if spec.File != "" {
+		if err := ioutil.WriteFile(spec.File, content, 0644); err != nil {
+			logrus.Warnf("Failed to write traces to %s: %s", spec.File, err)
+		}
+	}
+	if spec.Endpoint != "" {
+		if err := send(spec.Endpoint, content); err != nil {
+			logrus.Warnf("%s", err)
+		} else {
+			logrus.Debugf("Exported %d spans to %s", len(m.Spans()), spec.Endpoint)
+		}
+	}
+}
+
+// The endpoint is the base url of the collector, as in OTEL_EXPORTER_OTLP_ENDPOINT
+func send(endpoint string, content []byte) error {
+	target := strings.TrimRight(endpoint, "/") + "/v1/traces"
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(target, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to export traces to %s", target)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("Failed to export traces to %s. Status %s: %s", target, res.Status, string(body))
+	}
+	return nil
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func attributes(attributes []Attribute) []otlpAttribute {
+	result := make([]otlpAttribute, 0, len(attributes))
+	for _, attribute := range attributes {
+		value := otlpValue{}
+		switch v := attribute.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		case bool:
+			value.BoolValue = &v
+		default:
+			continue
+		}
+		result = append(result, otlpAttribute{Key: attribute.Key, Value: value})
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/skatteetaten/architect/pkg/config"
+	"sync"
+	"time"
+)
+
+// Spans are exported in the OTLP JSON encoding, so that they can be sent to any OpenTelemetry collector
+// without the collector libraries. See https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+const (
+	ServiceName = "architect"
+
+	KindInternal = 1
+	KindClient   = 3
+
+	StatusUnset = 0
+	StatusOk    = 1
+	StatusError = 2
+)
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer records the spans of one build. A nil tracer records nothing, so tracing can be left out of
+// the context when it is not configured.
+type Tracer struct {
+	Resource []Attribute
+	traceId  string
+	spans    []*Span
+	mutex    sync.Mutex
+}
+
+type Span struct {
+	tracer       *Tracer
+	TraceId      string
+	SpanId       string
+	ParentSpanId string
+	Name         string
+	Kind         int
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	Status       int
+	Message      string
+}
+
+type contextKey int
+
+const (
+	tracerKey contextKey = iota
+	spanKey
+)
+
+// NewTracer creates a tracer if tracing is configured, with the OpenShift build as resource attributes
+func NewTracer(cfg *config.Config) *Tracer {
+	if cfg.TracingSpec.Endpoint == "" && cfg.TracingSpec.File == "" {
+		return nil
+	}
+	resource := []Attribute{
+		{"service.name", ServiceName},
+		{"service.version", cfg.BuilderSpec.Version},
+	}
+	build := cfg.BuildMetadata
+	for _, attribute := range []Attribute{
+		{"k8s.namespace.name", build.Namespace},
+		{"openshift.build.name", build.Name},
+		{"openshift.build.number", build.BuildNumber},
+		{"openshift.build_config.name", build.BuildConfigName},
+		{"application.group_id", cfg.ApplicationSpec.MavenGav.GroupId},
+		{"application.artifact_id", cfg.ApplicationSpec.MavenGav.ArtifactId},
+		{"application.version", cfg.ApplicationSpec.MavenGav.Version},
+	} {
+		if attribute.Value != "" {
+			resource = append(resource, attribute)
+		}
+	}
+	return &Tracer{
+		Resource: resource,
+		traceId:  newId(16),
+	}
+}
+
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	if tracer == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey, tracer)
+}
+
+func FromContext(ctx context.Context) *Tracer {
+	tracer, _ := ctx.Value(tracerKey).(*Tracer)
+	return tracer
+}
+
+// StartSpan starts a span as a child of the span in the context. Returns a nil span if there is no
+// tracer in the context. The span must be ended with Finish.
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	tracer := FromContext(ctx)
+	if tracer == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer:  tracer,
+		TraceId: tracer.traceId,
+		SpanId:  newId(8),
+		Name:    name,
+		Kind:    kind,
+		Start:   time.Now(),
+	}
+	if parent, ok := ctx.Value(spanKey).(*Span); ok {
+		span.ParentSpanId = parent.SpanId
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+func (m *Span) SetAttribute(key string, value interface{}) {
+	if m == nil {
+		return
+	}
+	m.Attributes = append(m.Attributes, Attribute{key, value})
+}
+
+// Finish ends the span, with error status if err is not nil
+func (m *Span) Finish(err error) {
+	if m == nil {
+		return
+	}
+	m.End = time.Now()
+	if err != nil {
+		m.Status = StatusError
+		m.Message = err.Error()
+	}
+	m.tracer.mutex.Lock()
+	defer m.tracer.mutex.Unlock()
+	m.tracer.spans = append(m.tracer.spans, m)
+}
+
+// Spans returns the finished spans
+func (m *Tracer) Spans() []*Span {
+	if m == nil {
+		return nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]*Span{}, m.spans...)
+}
+
+// traceparent is the W3C trace context header, so that servers can join the trace
+func (m *Span) traceparent() string {
+	return "00-" + m.TraceId + "-" + m.SpanId + "-01"
+}
+
+func newId(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,119 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newConfig(spec config.TracingSpec) *config.Config {
+	return &config.Config{
+		TracingSpec: spec,
+		BuildMetadata: config.BuildMetadata{
+			Name:        "app-42",
+			Namespace:   "aurora",
+			BuildNumber: "42",
+		},
+		ApplicationSpec: config.ApplicationSpec{
+			MavenGav: config.MavenGav{ArtifactId: "app", GroupId: "no.skatteetaten.aurora", Version: "1.2.3"},
+		},
+	}
+}
+
+func TestNoTracerWhenNotConfigured(t *testing.T) {
+	tracer := tracing.NewTracer(newConfig(config.TracingSpec{}))
+	assert.Nil(t, tracer)
+
+	ctx, span := tracing.StartSpan(tracing.WithTracer(context.Background(), tracer), "build", tracing.KindInternal)
+	assert.Nil(t, span)
+	assert.Nil(t, tracing.FromContext(ctx))
+	span.SetAttribute("key", "value")
+	span.Finish(nil)
+	tracer.Export(config.TracingSpec{})
+}
+
+func TestSpansAndHttpCalls(t *testing.T) {
+	traceparent := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	tracer := tracing.NewTracer(newConfig(config.TracingSpec{File: "traces.json"}))
+	ctx, root := tracing.StartSpan(tracing.WithTracer(context.Background(), tracer), "build", tracing.KindInternal)
+	phaseCtx, phase := tracing.StartSpan(ctx, "download", tracing.KindInternal)
+
+	client := &http.Client{Transport: tracing.NewTransport(nil)}
+	req, _ := http.NewRequest("GET", server.URL+"/nexus?a=app", nil)
+	res, err := client.Do(req.WithContext(phaseCtx))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Empty(t, req.Header.Get("traceparent"), "The request of the caller should not be modified")
+
+	phase.Finish(errors.New("Nexus is not available"))
+	root.Finish(nil)
+
+	spans := tracer.Spans()
+	assert.Len(t, spans, 3)
+	call, download, build := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "HTTP GET", call.Name)
+	assert.Equal(t, tracing.KindClient, call.Kind)
+	assert.Equal(t, download.SpanId, call.ParentSpanId)
+	assert.Equal(t, tracing.StatusError, call.Status)
+	assert.Equal(t, "00-"+call.TraceId+"-"+call.SpanId+"-01", traceparent)
+
+	assert.Equal(t, build.SpanId, download.ParentSpanId)
+	assert.Equal(t, tracing.StatusError, download.Status)
+	assert.Equal(t, "Nexus is not available", download.Message)
+	assert.Equal(t, "", build.ParentSpanId)
+	assert.Equal(t, build.TraceId, call.TraceId)
+	assert.Len(t, build.TraceId, 32)
+	assert.Len(t, build.SpanId, 16)
+}
+
+func TestExport(t *testing.T) {
+	var path, contentType string
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	dir, err := ioutil.TempDir("", "tracing")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	spec := config.TracingSpec{Endpoint: collector.URL, File: filepath.Join(dir, "traces.json")}
+
+	tracer := tracing.NewTracer(newConfig(spec))
+	_, span := tracing.StartSpan(tracing.WithTracer(context.Background(), tracer), "retag", tracing.KindInternal)
+	span.SetAttribute("tags", 3)
+	span.Finish(nil)
+	tracer.Export(spec)
+
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/json", contentType)
+	content, err := ioutil.ReadFile(spec.File)
+	assert.NoError(t, err)
+	assert.Equal(t, body, content)
+
+	traces := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(content, &traces))
+	text := string(content)
+	assert.True(t, strings.Contains(text, `{"key":"openshift.build.name","value":{"stringValue":"app-42"}}`), text)
+	assert.True(t, strings.Contains(text, `{"key":"k8s.namespace.name","value":{"stringValue":"aurora"}}`), text)
+	assert.True(t, strings.Contains(text, `"name":"retag"`), text)
+	assert.True(t, strings.Contains(text, `{"key":"tags","value":{"intValue":"3"}}`), text)
+}
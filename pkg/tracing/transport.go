@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// Transport creates a client span for each request that has a tracer in its context
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	return &Transport{Base: base}
+}
+
+func (m *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := m.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	_, span := StartSpan(req.Context(), "HTTP "+req.Method, KindClient)
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request, so the header is added to a copy
+	traced := new(http.Request)
+	*traced = *req
+	traced.Header = make(http.Header, len(req.Header)+1)
+	for key, values := range req.Header {
+		traced.Header[key] = values
+	}
+	traced.Header.Set("traceparent", span.traceparent())
+
+	url := *req.URL
+	url.User = nil
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", url.String())
+	span.SetAttribute("net.peer.name", req.URL.Hostname())
+
+	res, err := base.RoundTrip(traced)
+	if err == nil {
+		span.SetAttribute("http.status_code", res.StatusCode)
+		if res.StatusCode >= 500 {
+			span.Status = StatusError
+			span.Message = res.Status
+		}
+	}
+	span.Finish(err)
+	return res, err
+}
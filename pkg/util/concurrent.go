@@ -0,0 +1,63 @@
+package util
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+)
+
+const DefaultConcurrency = 4
+
+// Errors are the errors of concurrent tasks, in the order of the tasks and not in the order they failed,
+// so that the result of a build does not depend on timing
+type Errors []error
+
+func (m Errors) Error() string {
+	messages := make([]string, 0, len(m))
+	for _, err := range m {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Cause is the cause of the first error, so that errors.Cause classifies the errors as the first of them
+func (m Errors) Cause() error {
+	return errors.Cause(m[0])
+}
+
+// RunConcurrently runs task for 0 to n-1 with at most limit tasks at a time. A limit below one uses
+// DefaultConcurrency. All tasks are run even if some of them fail. Returns nil, the error of the only
+// failed task, or Errors if several tasks failed.
+func RunConcurrently(ctx context.Context, n int, limit int, task func(ctx context.Context, i int) error) error {
+	if limit < 1 {
+		limit = DefaultConcurrency
+	}
+	results := make([]error, n)
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = task(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+
+	var failed Errors
+	for _, err := range results {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	}
+	return failed
+}
@@ -0,0 +1,63 @@
+package util_test
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunConcurrentlyIsLimited(t *testing.T) {
+	var running, maxRunning, done int32
+	err := util.RunConcurrently(context.Background(), 10, 3, func(ctx context.Context, i int) error {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&done, 1)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(10), done)
+	assert.True(t, maxRunning <= 3, "Expected at most 3 concurrent tasks, was %d", maxRunning)
+}
+
+func TestRunConcurrentlyErrorsAreInTaskOrder(t *testing.T) {
+	unauthorized := errors.New("unauthorized")
+	err := util.RunConcurrently(context.Background(), 4, 4, func(ctx context.Context, i int) error {
+		switch i {
+		case 1:
+			// Fails last, but is reported first
+			time.Sleep(20 * time.Millisecond)
+			return errors.Wrap(unauthorized, "Failed to push b")
+		case 3:
+			return errors.New("Failed to push d")
+		}
+		return nil
+	})
+
+	assert.Equal(t, "Failed to push b: unauthorized; Failed to push d", err.Error())
+	assert.Equal(t, unauthorized, errors.Cause(err))
+}
+
+func TestRunConcurrentlyReturnsSingleError(t *testing.T) {
+	failure := errors.New("Failed to push a")
+	err := util.RunConcurrently(context.Background(), 3, 0, func(ctx context.Context, i int) error {
+		if i == 0 {
+			return failure
+		}
+		return nil
+	})
+
+	assert.Equal(t, failure, err)
+	assert.NoError(t, util.RunConcurrently(context.Background(), 0, 0, nil))
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"context"
+	"github.com/Sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// NewSignalContext returns a context that is cancelled on SIGTERM or SIGINT, so that the build can stop
+// and clean up when OpenShift cancels it. A second signal terminates the process immediately.
+func NewSignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		select {
+		case sig := <-signals:
+			logrus.Warnf("Received %s, cancelling build", sig)
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+		sig := <-signals
+		logrus.Errorf("Received %s again, terminating", sig)
+		os.Exit(1)
+	}()
+	return ctx, cancel
+}
+
+// WithTimeout returns a context with the timeout, or without a deadline if the timeout is zero
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,25 @@
+package util
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const (
+	TextLogFormat = "text"
+	JsonLogFormat = "json"
+)
+
+// SetLogFormat sets the format of the log, either text for reading in the build log or json for log aggregation
+func SetLogFormat(format string) error {
+	switch strings.ToLower(format) {
+	case TextLogFormat, "":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case JsonLogFormat:
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return errors.Errorf("Unknown log format %s. Must be text or json", format)
+	}
+	return nil
+}
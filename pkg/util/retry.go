@@ -0,0 +1,158 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryAttempts   = 3
+	DefaultInitialBackoff  = 2 * time.Second
+	DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// RetryPolicy decides how many times an idempotent operation is tried. The zero value tries once.
+// The build config creates it with config.RetrySpec.RetryPolicy.
+type RetryPolicy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Do runs the operation until it succeeds, fails with an error that is not retryable or the attempts are used up.
+// The backoff doubles for each attempt, with jitter so that parallel builds do not retry in lockstep.
+func (m RetryPolicy) Do(ctx context.Context, description string, operation func() error) error {
+	attempts := m.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = operation()
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !IsRetryable(err) {
+			break
+		}
+		backoff := m.backoff(attempt)
+		logrus.Warnf("%s failed (attempt %d of %d), retrying in %s: %s", description, attempt, attempts,
+			backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Wrapf(err, "%s interrupted while waiting to retry", description)
+		}
+	}
+	return err
+}
+
+// The backoff before the next attempt is a random duration between half and all of the exponential backoff
+func (m RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := m.InitialBackoff
+	for i := 1; i < attempt && (m.MaxBackoff <= 0 || backoff < m.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if m.MaxBackoff > 0 && backoff > m.MaxBackoff {
+		backoff = m.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// StatusError is an unexpected HTTP status from a server
+type StatusError struct {
+	Url        string
+	StatusCode int
+	Status     string
+}
+
+func NewStatusError(res *http.Response) *StatusError {
+	return &StatusError{
+		Url:        res.Request.URL.String(),
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+	}
+}
+
+func (m *StatusError) Error() string {
+	return fmt.Sprintf("Unexpected status %s from %s", m.Status, m.Url)
+}
+
+// Temporary tells if a retry may succeed, i.e. for server errors and throttling
+func (m *StatusError) Temporary() bool {
+	return m.StatusCode >= 500 || m.StatusCode == http.StatusTooManyRequests ||
+		m.StatusCode == http.StatusRequestTimeout
+}
+
+// Errors from the Docker daemon are only messages, so they are recognized by these
+var transientMessages = []string{
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"unexpected EOF",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+	"500 Internal Server Error",
+	"429 Too Many Requests",
+}
+
+// IsRetryable tells if an error is transient: server errors, dropped connections and timeouts.
+// Cancellation and timeouts of our own context are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	cause := errors.Cause(err)
+	if cause == context.Canceled || cause == context.DeadlineExceeded {
+		return false
+	}
+	for e := cause; e != nil; e = unwrap(e) {
+		switch t := e.(type) {
+		case *StatusError:
+			return t.Temporary()
+		case net.Error:
+			if t.Timeout() {
+				return true
+			}
+		case syscall.Errno:
+			return t == syscall.ECONNRESET || t == syscall.ECONNREFUSED || t == syscall.EPIPE ||
+				t == syscall.ECONNABORTED || t == syscall.ETIMEDOUT
+		}
+		if e == io.EOF || e == io.ErrUnexpectedEOF {
+			return true
+		}
+	}
+	message := err.Error()
+	for _, transient := range transientMessages {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+func unwrap(err error) error {
+	switch t := err.(type) {
+	case *url.Error:
+		return t.Err
+	case *net.OpError:
+		return t.Err
+	case *os.SyscallError:
+		return t.Err
+	}
+	return nil
+}
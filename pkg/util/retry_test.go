@@ -0,0 +1,89 @@
+package util_test
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	connectionReset := &url.Error{
+		Op:  "Get",
+		URL: "http://nexus",
+		Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+	}
+	assert.True(t, util.IsRetryable(errors.Wrap(connectionReset, "Failed to get artifact")))
+	assert.True(t, util.IsRetryable(errors.Wrap(io.ErrUnexpectedEOF, "Failed to write to artifact file")))
+	assert.True(t, util.IsRetryable(&util.StatusError{StatusCode: 502, Status: "502 Bad Gateway"}))
+	assert.True(t, util.IsRetryable(&util.StatusError{StatusCode: 429, Status: "429 Too Many Requests"}))
+	assert.True(t, util.IsRetryable(errors.New("received unexpected HTTP status: 503 Service Unavailable")))
+
+	assert.False(t, util.IsRetryable(nil))
+	assert.False(t, util.IsRetryable(&util.StatusError{StatusCode: 404, Status: "404 Not Found"}))
+	assert.False(t, util.IsRetryable(errors.New("unauthorized: authentication required")))
+	assert.False(t, util.IsRetryable(errors.Wrap(context.Canceled, "Push interrupted")))
+	assert.False(t, util.IsRetryable(errors.Wrap(context.DeadlineExceeded, "Push interrupted")))
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := util.RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}
+
+	attempts := 0
+	err := policy.Do(context.Background(), "Flaky", func() error {
+		attempts++
+		if attempts < 3 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = policy.Do(context.Background(), "Broken", func() error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = policy.Do(context.Background(), "Missing", func() error {
+		attempts++
+		return errors.New("manifest unknown")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryPolicyStopsWhenCancelled(t *testing.T) {
+	policy := util.RetryPolicy{Attempts: 5, InitialBackoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	err := policy.Do(ctx, "Flaky", func() error {
+		attempts++
+		cancel()
+		return io.ErrUnexpectedEOF
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestZeroRetryPolicyTriesOnce(t *testing.T) {
+	attempts := 0
+	err := util.RetryPolicy{}.Do(context.Background(), "Flaky", func() error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
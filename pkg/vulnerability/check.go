@@ -0,0 +1,118 @@
+package vulnerability
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/sbom"
+	"strings"
+)
+
+type Finding struct {
+	Component     sbom.Component
+	Vulnerability Vulnerability
+}
+
+// Find matches the components against the database. Components without a group, i.e. jars without
+// pom.properties, are matched on artifactId only.
+func (m *Database) Find(components []sbom.Component) []Finding {
+	findings := make([]Finding, 0)
+	for _, component := range components {
+		for _, vulnerability := range m.Vulnerabilities {
+			if vulnerability.matches(component) {
+				findings = append(findings, Finding{Component: component, Vulnerability: vulnerability})
+			}
+		}
+	}
+	return findings
+}
+
+func (m Vulnerability) matches(component sbom.Component) bool {
+	if component.Name != m.ArtifactId {
+		return false
+	}
+	if m.GroupId != "" && component.Group != "" && component.Group != m.GroupId {
+		return false
+	}
+	if m.constraints == nil {
+		return true
+	}
+	v, err := version.NewVersion(component.Version)
+	if err != nil {
+		// We can not tell if the version is affected, so we rather report it
+		logrus.Warnf("Unable to compare version %s of %s with %s: %s", component.Version, component.Name, m.Id, err)
+		return true
+	}
+	return m.constraints.Check(v)
+}
+
+// Gate decides which findings fail the build and which are only reported
+type Gate struct {
+	Database *Database
+	FailOn   Severity
+	WarnOn   Severity
+}
+
+// NewGate creates a gate from the build config, or returns nil if no database is configured
+func NewGate(spec config.VulnerabilitySpec) (*Gate, error) {
+	if spec.DatabaseFile == "" {
+		return nil, nil
+	}
+	gate := &Gate{FailOn: High, WarnOn: Low}
+	var err error
+	if spec.FailSeverity != "" {
+		if gate.FailOn, err = ParseSeverity(spec.FailSeverity); err != nil {
+			return nil, errors.Wrap(err, "Invalid VULNERABILITY_FAIL_SEVERITY")
+		}
+	}
+	if spec.WarnSeverity != "" {
+		if gate.WarnOn, err = ParseSeverity(spec.WarnSeverity); err != nil {
+			return nil, errors.Wrap(err, "Invalid VULNERABILITY_WARN_SEVERITY")
+		}
+	}
+	gate.Database, err = ReadDatabaseFile(spec.DatabaseFile)
+	if err != nil {
+		return nil, err
+	}
+	return gate, nil
+}
+
+// Check reports the findings in the build log, and returns an error if any of them are severe enough to fail the build
+func (m *Gate) Check(components []sbom.Component) error {
+	findings := m.Database.Find(components)
+	failed := make([]string, 0)
+	for _, finding := range findings {
+		v := finding.Vulnerability
+		message := describe(finding)
+		if v.Severity.AtLeast(m.FailOn) {
+			logrus.Errorf("Vulnerable dependency: %s", message)
+			failed = append(failed, v.Id)
+		} else if v.Severity.AtLeast(m.WarnOn) {
+			logrus.Warnf("Vulnerable dependency: %s", message)
+		} else {
+			logrus.Debugf("Vulnerable dependency below threshold: %s", message)
+		}
+	}
+	logrus.Infof("Checked %d dependencies against %d known vulnerabilities, found %d",
+		len(components), len(m.Database.Vulnerabilities), len(findings))
+	if len(failed) > 0 {
+		return errors.Errorf("Found %d vulnerabilities with severity %s or higher: %s",
+			len(failed), m.FailOn, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func describe(finding Finding) string {
+	c := finding.Component
+	v := finding.Vulnerability
+	name := c.Name + ":" + c.Version
+	if c.Group != "" {
+		name = c.Group + ":" + name
+	}
+	message := v.Id + " (" + string(v.Severity) + ") in " + name
+	if v.Description != "" {
+		message += " - " + v.Description
+	}
+	return message
+}
@@ -0,0 +1,156 @@
+package vulnerability
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Severity string
+
+const (
+	None     Severity = "NONE"
+	Low      Severity = "LOW"
+	Medium   Severity = "MEDIUM"
+	High     Severity = "HIGH"
+	Critical Severity = "CRITICAL"
+)
+
+var severityRank = map[Severity]int{None: 0, Low: 1, Medium: 2, High: 3, Critical: 4}
+
+func ParseSeverity(s string) (Severity, error) {
+	severity := Severity(strings.ToUpper(strings.TrimSpace(s)))
+	if _, ok := severityRank[severity]; !ok {
+		return "", errors.Errorf("Unknown severity %s. Must be one of NONE, LOW, MEDIUM, HIGH or CRITICAL", s)
+	}
+	return severity, nil
+}
+
+// AtLeast returns true if the severity is the same as or more severe than the threshold. Nothing is at least NONE.
+func (m Severity) AtLeast(threshold Severity) bool {
+	if threshold == None {
+		return false
+	}
+	return severityRank[m] >= severityRank[threshold]
+}
+
+// Vulnerability is a known problem in a range of versions of a Maven artifact.
+type Vulnerability struct {
+	Id         string `json:"id"`
+	GroupId    string `json:"groupId"`
+	ArtifactId string `json:"artifactId"`
+	// Versions is a version constraint, e.g. ">= 2.0, < 2.15.0". All versions are affected if empty
+	Versions    string   `json:"versions"`
+	Severity    Severity `json:"severity"`
+	Description string   `json:"description"`
+
+	constraints version.Constraints
+}
+
+type Database struct {
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// ReadDatabaseFile reads a vulnerability database. Files ending with .csv are read as CSV, others as JSON.
+func ReadDatabaseFile(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open vulnerability database %s", path)
+	}
+	defer file.Close()
+
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		return ParseCsv(file)
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read vulnerability database %s", path)
+	}
+	return ParseJson(data)
+}
+
+// ParseJson reads a database in the form {"vulnerabilities": [{"id": "CVE-2021-44228", "groupId": ..}]}
+func ParseJson(data []byte) (*Database, error) {
+	database := &Database{}
+	if err := json.Unmarshal(data, database); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal vulnerability database")
+	}
+	if err := database.init(); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// ParseCsv reads a database with a header row naming the columns id, groupId, artifactId, versions,
+// severity and description. Column names are case insensitive and the order is free.
+func ParseCsv(reader io.Reader) (*Database, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comment = '#'
+	csvReader.TrimLeadingSpace = true
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read vulnerability database")
+	}
+	if len(records) == 0 {
+		return nil, errors.New("Vulnerability database has no header row")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"id", "artifactid", "severity"} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.Errorf("Vulnerability database has no %s column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	database := &Database{}
+	for _, record := range records[1:] {
+		database.Vulnerabilities = append(database.Vulnerabilities, Vulnerability{
+			Id:          field(record, "id"),
+			GroupId:     field(record, "groupid"),
+			ArtifactId:  field(record, "artifactid"),
+			Versions:    field(record, "versions"),
+			Severity:    Severity(field(record, "severity")),
+			Description: field(record, "description"),
+		})
+	}
+	if err := database.init(); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+func (m *Database) init() error {
+	for i := range m.Vulnerabilities {
+		v := &m.Vulnerabilities[i]
+		if v.ArtifactId == "" {
+			return errors.Errorf("Vulnerability %s has no artifactId", v.Id)
+		}
+		severity, err := ParseSeverity(string(v.Severity))
+		if err != nil {
+			return errors.Wrapf(err, "Invalid vulnerability %s", v.Id)
+		}
+		v.Severity = severity
+		if v.Versions != "" {
+			v.constraints, err = version.NewConstraint(v.Versions)
+			if err != nil {
+				return errors.Wrapf(err, "Invalid versions %s for vulnerability %s", v.Versions, v.Id)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package vulnerability_test
+
+import (
+	"github.com/skatteetaten/architect/pkg/config"
+	"github.com/skatteetaten/architect/pkg/sbom"
+	"github.com/skatteetaten/architect/pkg/vulnerability"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var components = []sbom.Component{
+	{Group: "org.slf4j", Name: "slf4j-api", Version: "1.7.6"},
+	{Group: "org.slf4j", Name: "slf4j-ext", Version: "1.7.25"},
+	{Group: "org.slf4j", Name: "log4j-over-slf4j", Version: "1.7.6"},
+	{Name: "slf4j-ext", Version: "1.7.30"},
+}
+
+func TestReadDatabaseFile(t *testing.T) {
+	for _, file := range []string{"testdata/vulnerabilities.json", "testdata/vulnerabilities.csv"} {
+		database, err := vulnerability.ReadDatabaseFile(file)
+		assert.NoError(t, err, file)
+		assert.Len(t, database.Vulnerabilities, 2, file)
+		assert.Equal(t, vulnerability.Critical, database.Vulnerabilities[0].Severity, file)
+		assert.Equal(t, ">= 1.7.0, < 1.7.26", database.Vulnerabilities[0].Versions, file)
+
+		findings := database.Find(components)
+		assert.Len(t, findings, 2, file)
+		assert.Equal(t, "TEST-0001", findings[0].Vulnerability.Id)
+		assert.Equal(t, "CVE-2018-8088", findings[1].Vulnerability.Id)
+		assert.Equal(t, "1.7.25", findings[1].Component.Version)
+	}
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	_, err := vulnerability.ParseJson([]byte(`{"vulnerabilities": [{"id": "X", "artifactId": "a", "severity": "BAD"}]}`))
+	assert.Error(t, err)
+
+	_, err = vulnerability.ParseJson([]byte(`{"vulnerabilities": [{"id": "X", "artifactId": "a", "severity": "LOW", "versions": "~~1"}]}`))
+	assert.Error(t, err)
+
+	_, err = vulnerability.ParseCsv(strings.NewReader("id,groupId\nX,a\n"))
+	assert.Error(t, err)
+}
+
+func TestGate(t *testing.T) {
+	gate, err := vulnerability.NewGate(config.VulnerabilitySpec{DatabaseFile: "testdata/vulnerabilities.json"})
+	assert.NoError(t, err)
+	err = gate.Check(components)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "CVE-2018-8088")
+	assert.NotContains(t, err.Error(), "TEST-0001")
+
+	gate, err = vulnerability.NewGate(config.VulnerabilitySpec{
+		DatabaseFile: "testdata/vulnerabilities.json",
+		FailSeverity: "none",
+		WarnSeverity: "medium",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, gate.Check(components))
+
+	_, err = vulnerability.NewGate(config.VulnerabilitySpec{DatabaseFile: "testdata/vulnerabilities.json", FailSeverity: "severe"})
+	assert.Error(t, err)
+
+	gate, err = vulnerability.NewGate(config.VulnerabilitySpec{})
+	assert.NoError(t, err)
+	assert.Nil(t, gate)
+}